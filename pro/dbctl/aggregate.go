@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// resultSet is a response carrying column metadata and rows.
+type resultSet struct {
+	Columns []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"columns"`
+	Rows       []map[string]interface{} `json:"rows"`
+	NextCursor string                   `json:"nextCursor,omitempty"`
+}
+
+// printResultSet prints rows in the column order reported by the server.
+func printResultSet(rs resultSet) error {
+	if outputFlag == "json" {
+		return printJSON(rs)
+	}
+	header := make([]string, len(rs.Columns))
+	for i, col := range rs.Columns {
+		header[i] = col.Name
+	}
+	rows := make([][]string, 0, len(rs.Rows))
+	for _, rec := range rs.Rows {
+		row := make([]string, len(header))
+		for i, col := range header {
+			row[i] = formatValue(rec[col])
+		}
+		rows = append(rows, row)
+	}
+	return printTable(header, rows)
+}
+
+// parseAggregate turns "func:column[:alias]" into an /aggregate column.
+func parseAggregate(spec string) (map[string]interface{}, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("expected func:column[:alias], got %q", spec)
+	}
+	col := map[string]interface{}{"func": strings.ToLower(parts[0]), "column": parts[1]}
+	if len(parts) == 3 {
+		col["alias"] = parts[2]
+	}
+	return col, nil
+}
+
+func newAggregateCommand() *cobra.Command {
+	var columns, aggregates, groupBy, order, where []string
+	var filterJSON, havingJSON string
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "aggregate DB TABLE",
+		Short: "Run a grouped aggregate query",
+		Example: `  dbctl aggregate shop orders --column country --agg count:*:orders --agg sum:total:revenue \
+    --group-by country --having '{"column":"orders","op":"gt","value":5}' --order -revenue`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var cols []map[string]interface{}
+			for _, c := range columns {
+				cols = append(cols, map[string]interface{}{"column": c})
+			}
+			for _, spec := range aggregates {
+				col, err := parseAggregate(spec)
+				if err != nil {
+					return err
+				}
+				cols = append(cols, col)
+			}
+
+			body := map[string]interface{}{
+				"dbname":  args[0],
+				"table":   args[1],
+				"columns": cols,
+				"groupBy": groupBy,
+				"limit":   limit,
+			}
+			if len(where) > 0 || filterJSON != "" {
+				f, err := whereFilter(where, filterJSON)
+				if err != nil {
+					return err
+				}
+				body["where"] = f
+			}
+			if havingJSON != "" {
+				var having interface{}
+				if err := json.Unmarshal([]byte(havingJSON), &having); err != nil {
+					return fmt.Errorf("invalid --having: %w", err)
+				}
+				body["having"] = having
+			}
+			var terms []map[string]interface{}
+			for _, col := range order {
+				terms = append(terms, map[string]interface{}{
+					"column": strings.TrimPrefix(col, "-"),
+					"desc":   strings.HasPrefix(col, "-"),
+				})
+			}
+			body["orderBy"] = terms
+
+			var rs resultSet
+			if err := call(http.MethodPost, "/aggregate", nil, body, &rs); err != nil {
+				return err
+			}
+			return printResultSet(rs)
+		},
+	}
+	cmd.Flags().StringSliceVar(&columns, "column", nil, "plain columns to return (usually the group-by columns)")
+	cmd.Flags().StringArrayVar(&aggregates, "agg", nil, "aggregate as func:column[:alias], func is count, sum, avg, min or max (repeatable)")
+	cmd.Flags().StringSliceVar(&groupBy, "group-by", nil, "columns to group by")
+	cmd.Flags().StringArrayVar(&where, "where", nil, "equality condition, e.g. --where status=paid (repeatable, ANDed)")
+	cmd.Flags().StringVar(&filterJSON, "filter", "", "structured WHERE filter as JSON")
+	cmd.Flags().StringVar(&havingJSON, "having", "", "structured HAVING filter as JSON over aliases")
+	cmd.Flags().StringSliceVar(&order, "order", nil, `sort columns or aliases, "-" prefix for descending`)
+	cmd.Flags().IntVar(&limit, "limit", 0, "maximum number of rows")
+	return cmd
+}
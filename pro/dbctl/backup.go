@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newBackupCommand() *cobra.Command {
+	var tables []string
+	var file string
+	cmd := &cobra.Command{
+		Use:   "backup DB",
+		Short: "Dump the rows of a database's tables to a SQL file",
+		Long: `Dump the rows of DB's tables, or of --tables, as INSERT statements
+qualified with the database. Each table is streamed from /export, so large
+tables are neither held in memory nor subject to --timeout. Restore into
+existing tables with "mysql < FILE".`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(tables) == 0 {
+				var err error
+				if tables, err = baseTables(args[0]); err != nil {
+					return err
+				}
+			}
+
+			taken := time.Now().UTC()
+			if file == "" {
+				file = fmt.Sprintf("%s-%s.sql", args[0], taken.Format("20060102T150405Z"))
+			}
+			f, err := os.Create(file)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(f, "-- Backup of %s taken %s\n", args[0], taken.Format(time.RFC3339))
+			for _, table := range tables {
+				query := url.Values{"dbname": {args[0]}, "table": {table}, "format": {"sql"}}
+				if err := stream(f, http.MethodGet, "/export", query, nil); err != nil {
+					// Do not leave a truncated backup behind.
+					f.Close()
+					os.Remove(file)
+					return fmt.Errorf("backing up %s: %w", table, err)
+				}
+			}
+			if err := f.Close(); err != nil {
+				os.Remove(file)
+				return err
+			}
+
+			summary := map[string]interface{}{"message": "Backup written to " + file, "file": file, "tables": len(tables)}
+			return printMessage(summary)
+		},
+	}
+	cmd.Flags().StringSliceVar(&tables, "tables", nil, "tables to back up (comma-separated, default all)")
+	cmd.Flags().StringVarP(&file, "file", "f", "", "output file (default DB-<timestamp>.sql)")
+	return cmd
+}
+
+// baseTables lists the tables of dbname, leaving out views, whose rows
+// belong to other tables.
+func baseTables(dbname string) ([]string, error) {
+	var resp struct {
+		Tables []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"tables"`
+	}
+	if err := call(http.MethodGet, "/tables", url.Values{"dbname": {dbname}}, nil, &resp); err != nil {
+		return nil, err
+	}
+	var tables []string
+	for _, t := range resp.Tables {
+		if t.Type == "BASE TABLE" {
+			tables = append(tables, t.Name)
+		}
+	}
+	return tables, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// cacheStats is the body of a node's /cache response.
+type cacheStats struct {
+	Enabled       bool    `json:"enabled"`
+	Entries       int     `json:"entries"`
+	Bytes         int64   `json:"bytes"`
+	MaxEntries    int     `json:"maxEntries"`
+	MaxBytes      int64   `json:"maxBytes"`
+	TTL           string  `json:"ttl"`
+	Hits          int64   `json:"hits"`
+	Misses        int64   `json:"misses"`
+	HitRatio      float64 `json:"hitRatio"`
+	Evictions     int64   `json:"evictions"`
+	Expired       int64   `json:"expired"`
+	Invalidations int64   `json:"invalidations"`
+}
+
+func newCacheCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect and empty the per-node /select result caches",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "stats",
+		Short: "Show the result cache statistics of every node",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			all := map[string]interface{}{}
+			var rows [][]string
+			for _, address := range nodes() {
+				var stats cacheStats
+				if err := callNode(address, http.MethodGet, "/cache", nil, nil, &stats); err != nil {
+					all[address] = map[string]string{"error": err.Error()}
+					rows = append(rows, []string{address, "error: " + err.Error(), "", "", "", ""})
+					continue
+				}
+				all[address] = stats
+				if !stats.Enabled {
+					rows = append(rows, []string{address, "disabled", "", "", "", ""})
+					continue
+				}
+				rows = append(rows, []string{
+					address,
+					fmt.Sprintf("%d/%d", stats.Entries, stats.MaxEntries),
+					fmt.Sprintf("%d/%d", stats.Bytes, stats.MaxBytes),
+					fmt.Sprintf("%d/%d (%.0f%%)", stats.Hits, stats.Hits+stats.Misses, stats.HitRatio*100),
+					strconv.FormatInt(stats.Evictions+stats.Expired, 10),
+					strconv.FormatInt(stats.Invalidations, 10),
+				})
+			}
+			if outputFlag == "json" {
+				return printJSON(all)
+			}
+			return printTable([]string{"NODE", "ENTRIES", "BYTES", "HITS", "EVICTED", "INVALIDATIONS"}, rows)
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "purge",
+		Short: "Empty the result cache of every node (needs the admin token)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var failed []string
+			for _, address := range nodes() {
+				if err := callNode(address, http.MethodDelete, "/cache", nil, nil, nil); err != nil {
+					failed = append(failed, err.Error())
+				}
+			}
+			if len(failed) > 0 {
+				return fmt.Errorf("purge failed on %d node(s): %s", len(failed), strings.Join(failed, "; "))
+			}
+			return printMessage(map[string]interface{}{"message": "Result caches purged"})
+		},
+	})
+	return cmd
+}
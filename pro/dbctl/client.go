@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// nodeStatus is the body of a node's /readyz response.
+type nodeStatus struct {
+	Address      string `json:"-"`
+	Status       string `json:"status"`
+	Role         string `json:"role"`
+	Master       string `json:"master"`
+	MySQL        string `json:"mysql"`
+	ShuttingDown bool   `json:"shuttingDown"`
+	Replication  struct {
+		Slaves    []string `json:"slaves"`
+		Pending   int      `json:"pending"`
+		Delivered int64    `json:"delivered"`
+		Failed    int64    `json:"failed"`
+	} `json:"replication"`
+	Err string `json:"-"`
+}
+
+func httpClient() *http.Client {
+	return &http.Client{Timeout: timeout}
+}
+
+// fetchStatus returns the readiness report of the node at address. Errors are
+// recorded in the result rather than returned so a status table can show
+// unreachable nodes.
+func fetchStatus(address string) nodeStatus {
+	status := nodeStatus{Address: address}
+	resp, err := httpClient().Get(address + "/readyz")
+	if err != nil {
+		status.Status = "down"
+		status.Err = err.Error()
+		return status
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		status.Status = "unknown"
+		status.Err = err.Error()
+	}
+	return status
+}
+
+// leader returns the address of the node that currently reports itself as
+// master and is ready.
+func leader() (string, error) {
+	for _, address := range nodes() {
+		status := fetchStatus(address)
+		if status.Role == "master" && status.Status == "ready" {
+			return address, nil
+		}
+	}
+	return "", fmt.Errorf("no ready master found among %s", strings.Join(nodes(), ", "))
+}
+
+// call sends a request to path on the leader. body, if non-nil, is encoded as
+// JSON. The response body is decoded into out when out is non-nil.
+func call(method, path string, query url.Values, body, out interface{}) error {
+	address, err := leader()
+	if err != nil {
+		return err
+	}
+	return callNode(address, method, path, query, body, out)
+}
+
+func callNode(address, method, path string, query url.Values, body, out interface{}) error {
+	_, err := callNodeWithHeader(address, method, path, query, body, out)
+	return err
+}
+
+// callWithHeader is call, additionally returning the response headers.
+func callWithHeader(method, path string, query url.Values, body, out interface{}) (http.Header, error) {
+	address, err := leader()
+	if err != nil {
+		return nil, err
+	}
+	return callNodeWithHeader(address, method, path, query, body, out)
+}
+
+func callNodeWithHeader(address, method, path string, query url.Values, body, out interface{}) (http.Header, error) {
+	resp, err := send(httpClient(), address, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return resp.Header, nil
+	}
+	// Keep numbers exact; BIGINT values do not fit in a float64.
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	return resp.Header, dec.Decode(out)
+}
+
+// stream sends a request to path on the leader and copies the response body
+// to dst as it arrives. It is not subject to --timeout, which would cut off
+// long result streams, and asks the node for its longest request timeout.
+func stream(dst io.Writer, method, path string, query url.Values, body interface{}) error {
+	address, err := leader()
+	if err != nil {
+		return err
+	}
+	resp, err := send(&http.Client{}, address, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		return err
+	}
+	if msg := resp.Trailer.Get("X-Stream-Error"); msg != "" {
+		return fmt.Errorf("%s %s: stream failed: %s", method, path, msg)
+	}
+	return nil
+}
+
+// send issues a request and returns the response if its status is 200 OK.
+func send(client *http.Client, address, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	target := address + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if tokenFlag != "" {
+		req.Header.Set("Authorization", "Bearer "+tokenFlag)
+	}
+	// The node stops working on the request once the client gives up on it.
+	if client.Timeout > 0 {
+		req.Header.Set("X-Request-Timeout", client.Timeout.String())
+	} else {
+		req.Header.Set("X-Request-Timeout", "max")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
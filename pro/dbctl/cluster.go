@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+func newClusterCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cluster",
+		Short: "Inspect the cluster",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Show the role and readiness of every node",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var statuses []nodeStatus
+			for _, address := range nodes() {
+				statuses = append(statuses, fetchStatus(address))
+			}
+			if outputFlag == "json" {
+				out := make([]map[string]interface{}, 0, len(statuses))
+				for _, s := range statuses {
+					out = append(out, map[string]interface{}{
+						"node":   s.Address,
+						"status": s.Status,
+						"role":   s.Role,
+						"master": s.Master,
+						"mysql":  s.MySQL,
+						"error":  s.Err,
+					})
+				}
+				return printJSON(out)
+			}
+
+			rows := make([][]string, 0, len(statuses))
+			for _, s := range statuses {
+				detail := s.Err
+				if detail == "" {
+					detail = "mysql " + s.MySQL
+				}
+				rows = append(rows, []string{s.Address, s.Role, s.Status, s.Master, detail})
+			}
+			return printTable([]string{"NODE", "ROLE", "STATUS", "MASTER", "DETAIL"}, rows)
+		},
+	})
+	return cmd
+}
+
+func newPromoteCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "promote NODE",
+		Short: "Promote the node at the given address to master",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp map[string]interface{}
+			if err := callNode(args[0], http.MethodPost, "/promote", nil, nil, &resp); err != nil {
+				return err
+			}
+			return printMessage(resp)
+		},
+	}
+}
+
+func newReplicationCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replication",
+		Short: "Inspect replication",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Show outstanding and completed replication on every node",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var statuses []nodeStatus
+			for _, address := range nodes() {
+				statuses = append(statuses, fetchStatus(address))
+			}
+			if outputFlag == "json" {
+				out := make([]map[string]interface{}, 0, len(statuses))
+				for _, s := range statuses {
+					out = append(out, map[string]interface{}{
+						"node":        s.Address,
+						"role":        s.Role,
+						"replication": s.Replication,
+						"error":       s.Err,
+					})
+				}
+				return printJSON(out)
+			}
+
+			rows := make([][]string, 0, len(statuses))
+			for _, s := range statuses {
+				if s.Err != "" {
+					rows = append(rows, []string{s.Address, s.Status, "-", "-", "-", "-"})
+					continue
+				}
+				rows = append(rows, []string{
+					s.Address,
+					s.Role,
+					fmt.Sprint(len(s.Replication.Slaves)),
+					strconv.Itoa(s.Replication.Pending),
+					strconv.FormatInt(s.Replication.Delivered, 10),
+					strconv.FormatInt(s.Replication.Failed, 10),
+				})
+			}
+			return printTable([]string{"NODE", "ROLE", "SLAVES", "PENDING", "DELIVERED", "FAILED"}, rows)
+		},
+	})
+	return cmd
+}
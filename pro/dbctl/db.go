@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+)
+
+func newDBCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "List, create or drop databases",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the databases",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp struct {
+				Databases []string `json:"databases"`
+			}
+			if err := call(http.MethodGet, "/databases", nil, nil, &resp); err != nil {
+				return err
+			}
+			if outputFlag == "json" {
+				return printJSON(resp)
+			}
+			rows := make([][]string, len(resp.Databases))
+			for i, name := range resp.Databases {
+				rows[i] = []string{name}
+			}
+			return printTable([]string{"DATABASE"}, rows)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "create NAME",
+		Short: "Create a database on every node",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp map[string]interface{}
+			if err := call(http.MethodGet, "/createdb", url.Values{"name": {args[0]}}, nil, &resp); err != nil {
+				return err
+			}
+			return printMessage(resp)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "drop NAME",
+		Short: "Drop a database on every node",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp map[string]interface{}
+			if err := call(http.MethodGet, "/dropdb", url.Values{"name": {args[0]}}, nil, &resp); err != nil {
+				return err
+			}
+			return printMessage(resp)
+		},
+	})
+
+	return cmd
+}
+
+func newTableCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "table",
+		Short: "Manage tables",
+	}
+
+	var schema string
+	create := &cobra.Command{
+		Use:   "create DB TABLE",
+		Short: "Create a table on every node",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := url.Values{"dbname": {args[0]}, "table": {args[1]}, "schema": {schema}}
+			var resp map[string]interface{}
+			if err := call(http.MethodGet, "/createtable", query, nil, &resp); err != nil {
+				return err
+			}
+			return printMessage(resp)
+		},
+	}
+	create.Flags().StringVar(&schema, "schema", "", `column definitions, e.g. "id INT PRIMARY KEY, name VARCHAR(50)"`)
+	create.MarkFlagRequired("schema")
+	cmd.AddCommand(create)
+	cmd.AddCommand(newTableDDLCommands()...)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list DB",
+		Short: "List the tables of a database",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp struct {
+				Tables []struct {
+					Name        string `json:"name"`
+					Type        string `json:"type"`
+					RowEstimate *int64 `json:"rowEstimate"`
+				} `json:"tables"`
+			}
+			if err := call(http.MethodGet, "/tables", url.Values{"dbname": {args[0]}}, nil, &resp); err != nil {
+				return err
+			}
+			if outputFlag == "json" {
+				return printJSON(resp)
+			}
+			rows := make([][]string, len(resp.Tables))
+			for i, t := range resp.Tables {
+				rows[i] = []string{t.Name, t.Type, formatEstimate(t.RowEstimate)}
+			}
+			return printTable([]string{"TABLE", "TYPE", "ROWS (EST.)"}, rows)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "describe DB TABLE",
+		Short: "Show the columns and indexes of a table",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var desc tableDescription
+			query := url.Values{"dbname": {args[0]}, "table": {args[1]}}
+			if err := call(http.MethodGet, "/describe", query, nil, &desc); err != nil {
+				return err
+			}
+			if outputFlag == "json" {
+				return printJSON(desc)
+			}
+			return printDescription(desc)
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// ddlCall runs a GET DDL endpoint on the leader and prints its message.
+func ddlCall(path string, query url.Values) error {
+	var resp map[string]interface{}
+	if err := call(http.MethodGet, path, query, nil, &resp); err != nil {
+		return err
+	}
+	return printMessage(resp)
+}
+
+// newTableDDLCommands returns the table subcommands that change or remove
+// an existing table.
+func newTableDDLCommands() []*cobra.Command {
+	var definition, after, to string
+	alter := &cobra.Command{
+		Use:   "alter DB TABLE add|drop|modify|rename COLUMN",
+		Short: "Add, drop, modify or rename a column on every node",
+		Args:  cobra.ExactArgs(4),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := url.Values{"dbname": {args[0]}, "table": {args[1]}, "action": {args[2]}, "column": {args[3]}}
+			for key, value := range map[string]string{"definition": definition, "after": after, "to": to} {
+				if value != "" {
+					query.Set(key, value)
+				}
+			}
+			return ddlCall("/altertable", query)
+		},
+	}
+	alter.Flags().StringVar(&definition, "definition", "", `column type and options for add/modify, e.g. "VARCHAR(100) NOT NULL"`)
+	alter.Flags().StringVar(&after, "after", "", "place the column after this one (add/modify)")
+	alter.Flags().StringVar(&to, "to", "", "new column name (rename)")
+
+	var newName string
+	rename := &cobra.Command{
+		Use:   "rename DB TABLE",
+		Short: "Rename a table on every node",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ddlCall("/renametable", url.Values{"dbname": {args[0]}, "table": {args[1]}, "to": {newName}})
+		},
+	}
+	rename.Flags().StringVar(&newName, "to", "", "new table name")
+	rename.MarkFlagRequired("to")
+
+	return []*cobra.Command{
+		alter,
+		{
+			Use:   "drop DB TABLE",
+			Short: "Drop a table on every node",
+			Args:  cobra.ExactArgs(2),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return ddlCall("/droptable", url.Values{"dbname": {args[0]}, "table": {args[1]}})
+			},
+		},
+		{
+			Use:   "truncate DB TABLE",
+			Short: "Remove every row of a table on every node",
+			Args:  cobra.ExactArgs(2),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return ddlCall("/truncate", url.Values{"dbname": {args[0]}, "table": {args[1]}})
+			},
+		},
+		rename,
+		{
+			Use:   "versioning DB TABLE on|off",
+			Short: "Add or remove the cluster-managed _version column used by update --expect-version",
+			Args:  cobra.ExactArgs(3),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				method := http.MethodPost
+				switch args[2] {
+				case "on":
+				case "off":
+					method = http.MethodDelete
+				default:
+					return fmt.Errorf("expected on or off, got %q", args[2])
+				}
+				var resp map[string]interface{}
+				if err := call(method, "/versioning", url.Values{"dbname": {args[0]}, "table": {args[1]}}, nil, &resp); err != nil {
+					return err
+				}
+				return printMessage(resp)
+			},
+		},
+	}
+}
+
+func newIndexCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "index",
+		Short: "Create or drop indexes",
+	}
+
+	var columns []string
+	var unique bool
+	create := &cobra.Command{
+		Use:   "create DB TABLE NAME",
+		Short: "Create an index on every node",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ddlCall("/createindex", url.Values{
+				"dbname":  {args[0]},
+				"table":   {args[1]},
+				"name":    {args[2]},
+				"columns": {strings.Join(columns, ",")},
+				"unique":  {strconv.FormatBool(unique)},
+			})
+		},
+	}
+	create.Flags().StringSliceVar(&columns, "columns", nil, "indexed columns, in order")
+	create.Flags().BoolVar(&unique, "unique", false, "create a unique index")
+	create.MarkFlagRequired("columns")
+	cmd.AddCommand(create)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "drop DB TABLE NAME",
+		Short: "Drop an index on every node",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ddlCall("/dropindex", url.Values{"dbname": {args[0]}, "table": {args[1]}, "name": {args[2]}})
+		},
+	})
+
+	return cmd
+}
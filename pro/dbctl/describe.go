@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tableDescription is the /describe response.
+type tableDescription struct {
+	Database    string   `json:"dbname"`
+	Table       string   `json:"table"`
+	Type        string   `json:"type"`
+	Engine      string   `json:"engine,omitempty"`
+	RowEstimate *int64   `json:"rowEstimate"`
+	PrimaryKey  []string `json:"primaryKey"`
+	Columns     []struct {
+		Name     string  `json:"name"`
+		Type     string  `json:"type"`
+		Nullable bool    `json:"nullable"`
+		Default  *string `json:"default"`
+		Key      string  `json:"key,omitempty"`
+		Extra    string  `json:"extra,omitempty"`
+	} `json:"columns"`
+	Indexes []struct {
+		Name    string   `json:"name"`
+		Unique  bool     `json:"unique"`
+		Type    string   `json:"type"`
+		Columns []string `json:"columns"`
+	} `json:"indexes"`
+}
+
+// formatEstimate prints an optional row estimate.
+func formatEstimate(n *int64) string {
+	if n == nil {
+		return "-"
+	}
+	return "~" + strconv.FormatInt(*n, 10)
+}
+
+// printDescription prints a table's columns followed by its indexes.
+func printDescription(desc tableDescription) error {
+	fmt.Printf("%s.%s (%s, %s, %s rows)\n\n", desc.Database, desc.Table, desc.Type, desc.Engine, formatEstimate(desc.RowEstimate))
+
+	rows := make([][]string, len(desc.Columns))
+	for i, col := range desc.Columns {
+		def := "NULL"
+		if col.Default != nil {
+			def = *col.Default
+		}
+		rows[i] = []string{col.Name, col.Type, strconv.FormatBool(col.Nullable), def, col.Key, col.Extra}
+	}
+	if err := printTable([]string{"COLUMN", "TYPE", "NULLABLE", "DEFAULT", "KEY", "EXTRA"}, rows); err != nil {
+		return err
+	}
+	if len(desc.Indexes) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	rows = make([][]string, len(desc.Indexes))
+	for i, idx := range desc.Indexes {
+		rows[i] = []string{idx.Name, strconv.FormatBool(idx.Unique), idx.Type, strings.Join(idx.Columns, ", ")}
+	}
+	return printTable([]string{"INDEX", "UNIQUE", "TYPE", "COLUMNS"}, rows)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// explainResult is the body of a node's /explain response.
+type explainResult struct {
+	SQL     string          `json:"sql"`
+	Params  []interface{}   `json:"params"`
+	Plan    json.RawMessage `json:"plan"`
+	Summary struct {
+		Cost          float64 `json:"cost"`
+		EstimatedRows int64   `json:"estimatedRows"`
+		Tables        []struct {
+			Table        string  `json:"table"`
+			Access       string  `json:"access"`
+			Index        string  `json:"index"`
+			RowsExamined int64   `json:"rowsExamined"`
+			Filtered     float64 `json:"filtered"`
+		} `json:"tables"`
+		Warnings []string `json:"warnings"`
+	} `json:"summary"`
+}
+
+// explain asks the leader for the plan of body, an /explain request, and
+// prints it: the summary as a table, or the whole response with -o json.
+func explain(body interface{}) error {
+	var res explainResult
+	if err := call(http.MethodPost, "/explain", nil, body, &res); err != nil {
+		return err
+	}
+	if outputFlag == "json" {
+		return printJSON(res)
+	}
+	fmt.Println(res.SQL)
+	var rows [][]string
+	for _, t := range res.Summary.Tables {
+		index := t.Index
+		if index == "" {
+			index = "-"
+		}
+		rows = append(rows, []string{
+			t.Table,
+			t.Access,
+			index,
+			strconv.FormatInt(t.RowsExamined, 10),
+			strconv.FormatFloat(t.Filtered, 'f', -1, 64) + "%",
+		})
+	}
+	if err := printTable([]string{"TABLE", "ACCESS", "INDEX", "ROWS", "FILTERED"}, rows); err != nil {
+		return err
+	}
+	fmt.Printf("(estimated %d rows, cost %s)\n", res.Summary.EstimatedRows, strconv.FormatFloat(res.Summary.Cost, 'f', -1, 64))
+	if len(res.Summary.Warnings) > 0 {
+		fmt.Println("warning: " + strings.Join(res.Summary.Warnings, "\nwarning: "))
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func newExportCommand() *cobra.Command {
+	var columns, where, order []string
+	var filterJSON, format, file string
+	var limit int
+	var compress bool
+	cmd := &cobra.Command{
+		Use:   "export DB TABLE",
+		Short: "Download a table or filtered rows as CSV, JSON Lines or SQL",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			body := map[string]interface{}{
+				"dbname":  args[0],
+				"table":   args[1],
+				"columns": columns,
+				"limit":   limit,
+			}
+			if len(where) > 0 || filterJSON != "" {
+				f, err := whereFilter(where, filterJSON)
+				if err != nil {
+					return err
+				}
+				body["where"] = f
+			}
+			var terms []map[string]interface{}
+			for _, col := range order {
+				terms = append(terms, map[string]interface{}{
+					"column": strings.TrimPrefix(col, "-"),
+					"desc":   strings.HasPrefix(col, "-"),
+				})
+			}
+			body["orderBy"] = terms
+
+			query := url.Values{"format": {format}}
+			if compress {
+				query.Set("gzip", "true")
+			}
+
+			var dst io.Writer = os.Stdout
+			if file != "" {
+				f, err := os.Create(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				dst = f
+			}
+			if err := stream(dst, http.MethodPost, "/export", query, body); err != nil {
+				if file != "" {
+					// Do not leave a truncated export behind.
+					os.Remove(file)
+				}
+				return err
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "csv", "csv, jsonl or sql")
+	cmd.Flags().BoolVar(&compress, "gzip", false, "gzip-compress the export")
+	cmd.Flags().StringVarP(&file, "file", "f", "", "write to FILE instead of stdout")
+	cmd.Flags().StringSliceVar(&columns, "columns", nil, "columns to export (default all)")
+	cmd.Flags().StringArrayVar(&where, "where", nil, `equality condition, e.g. --where id=1 (repeatable, ANDed)`)
+	cmd.Flags().StringVar(&filterJSON, "filter", "", `structured filter as JSON, e.g. '{"column":"age","op":"gt","value":30}'`)
+	cmd.Flags().StringSliceVar(&order, "order", nil, `sort columns, "-" prefix for descending, e.g. --order name,-id`)
+	cmd.Flags().IntVar(&limit, "limit", 0, "maximum number of rows")
+	return cmd
+}
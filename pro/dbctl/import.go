@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func newImportCommand() *cobra.Command {
+	var delimiter, quote, null string
+	var dryRun bool
+	var chunkSize int
+	cmd := &cobra.Command{
+		Use:   "import DB TABLE FILE",
+		Short: "Load a CSV file (header row = column names) into a table",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, err := os.Open(args[2])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			query := url.Values{"dbname": {args[0]}, "table": {args[1]}, "dryRun": {strconv.FormatBool(dryRun)}}
+			if delimiter != "" {
+				query.Set("delimiter", delimiter)
+			}
+			if quote != "" {
+				query.Set("quote", quote)
+			}
+			if cmd.Flags().Changed("null") {
+				query.Set("null", null)
+			}
+			if chunkSize > 0 {
+				query.Set("chunkSize", strconv.Itoa(chunkSize))
+			}
+
+			address, err := leader()
+			if err != nil {
+				return err
+			}
+			// Large files can take longer than --timeout to load.
+			resp, err := (&http.Client{}).Post(address+"/import?"+query.Encode(), "text/csv", file)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				msg, _ := io.ReadAll(resp.Body)
+				return fmt.Errorf("POST /import: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+			}
+
+			var result struct {
+				Message  string `json:"message"`
+				Valid    int    `json:"valid"`
+				Inserted int    `json:"inserted"`
+				Failed   int    `json:"failed"`
+				Errors   []struct {
+					Row   int    `json:"row"`
+					Error string `json:"error"`
+				} `json:"errors"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+				return err
+			}
+			if outputFlag == "json" {
+				return printJSON(result)
+			}
+			fmt.Println(result.Message)
+			if dryRun {
+				fmt.Printf("%d valid, %d failed\n", result.Valid, result.Failed)
+			} else {
+				fmt.Printf("%d inserted, %d failed\n", result.Inserted, result.Failed)
+			}
+			if len(result.Errors) == 0 {
+				return nil
+			}
+			rows := make([][]string, len(result.Errors))
+			for i, e := range result.Errors {
+				rows[i] = []string{strconv.Itoa(e.Row), e.Error}
+			}
+			return printTable([]string{"LINE", "ERROR"}, rows)
+		},
+	}
+	cmd.Flags().StringVar(&delimiter, "delimiter", "", `field delimiter (default ","; "tab" for tabs)`)
+	cmd.Flags().StringVar(&quote, "quote", "", `quote character (default '"')`)
+	cmd.Flags().StringVar(&null, "null", "", `field value to load as NULL, e.g. --null '\N'`)
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "validate and convert the file without writing")
+	cmd.Flags().IntVar(&chunkSize, "chunk-size", 0, "rows per transaction (default 500)")
+	return cmd
+}
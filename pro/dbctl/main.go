@@ -0,0 +1,85 @@
+// Command dbctl operates the distributed database cluster from the command
+// line. It discovers the current master automatically and talks to the nodes
+// over the same HTTP API as the web interface.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	nodesFlag  string
+	outputFlag string
+	tokenFlag  string
+	timeout    time.Duration
+)
+
+func main() {
+	root := &cobra.Command{
+		Use:           "dbctl",
+		Short:         "Operate the distributed database cluster",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if outputFlag != "table" && outputFlag != "json" {
+				return fmt.Errorf("unknown output format %q (want table or json)", outputFlag)
+			}
+			return nil
+		},
+	}
+
+	defaultNodes := os.Getenv("DBCTL_NODES")
+	if defaultNodes == "" {
+		defaultNodes = "http://localhost:8001,http://localhost:8002,http://localhost:8003"
+	}
+	root.PersistentFlags().StringVar(&nodesFlag, "nodes", defaultNodes, "comma-separated node addresses (env DBCTL_NODES)")
+	root.PersistentFlags().StringVarP(&outputFlag, "output", "o", "table", "output format: table or json")
+	root.PersistentFlags().StringVar(&tokenFlag, "token", os.Getenv("DBCTL_TOKEN"), "admin token sent as a bearer token (env DBCTL_TOKEN)")
+	root.PersistentFlags().DurationVar(&timeout, "timeout", 10*time.Second, "HTTP timeout per request, also sent to the node as its deadline")
+
+	root.AddCommand(
+		newDBCommand(),
+		newTableCommand(),
+		newIndexCommand(),
+		newMigrationCommand(),
+		newInsertCommand(),
+		newUpsertCommand(),
+		newImportCommand(),
+		newExportCommand(),
+		newSelectCommand(),
+		newAggregateCommand(),
+		newQueryCommand(),
+		newNamedQueryCommand(),
+		newUpdateCommand(),
+		newDeleteCommand(),
+		newTransactionCommand(),
+		newClusterCommand(),
+		newCacheCommand(),
+		newQueriesCommand(),
+		newPromoteCommand(),
+		newReplicationCommand(),
+		newBackupCommand(),
+	)
+
+	if err := root.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// nodes returns the configured node addresses without trailing slashes.
+func nodes() []string {
+	var list []string
+	for _, n := range strings.Split(nodesFlag, ",") {
+		n = strings.TrimRight(strings.TrimSpace(n), "/")
+		if n != "" {
+			list = append(list, n)
+		}
+	}
+	return list
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+func newMigrationCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migration",
+		Short: "Register, list, apply and roll back schema migrations",
+	}
+
+	var upFile, downFile string
+	add := &cobra.Command{
+		Use:   "add DB VERSION NAME",
+		Short: "Register a migration; VERSION must exceed every registered one",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid version %q", args[1])
+			}
+			up, err := os.ReadFile(upFile)
+			if err != nil {
+				return err
+			}
+			body := map[string]interface{}{"dbname": args[0], "version": version, "name": args[2], "up": string(up)}
+			if downFile != "" {
+				down, err := os.ReadFile(downFile)
+				if err != nil {
+					return err
+				}
+				body["down"] = string(down)
+			}
+			var resp map[string]interface{}
+			if err := call(http.MethodPost, "/migrations", nil, body, &resp); err != nil {
+				return err
+			}
+			return printMessage(resp)
+		},
+	}
+	add.Flags().StringVar(&upFile, "up", "", "file with the SQL that applies the migration")
+	add.Flags().StringVar(&downFile, "down", "", "file with the SQL that reverts the migration")
+	add.MarkFlagRequired("up")
+	cmd.AddCommand(add)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list DB",
+		Short: "List the migrations of a database and which are applied",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp struct {
+				DBName     string `json:"dbname"`
+				Version    int    `json:"version"`
+				Migrations []struct {
+					Version int    `json:"version"`
+					Name    string `json:"name"`
+					Down    string `json:"down,omitempty"`
+					Applied bool   `json:"applied"`
+				} `json:"migrations"`
+			}
+			if err := call(http.MethodGet, "/migrations", url.Values{"dbname": {args[0]}}, nil, &resp); err != nil {
+				return err
+			}
+			if outputFlag == "json" {
+				return printJSON(resp)
+			}
+			fmt.Printf("%s is at version %d\n\n", resp.DBName, resp.Version)
+			rows := make([][]string, len(resp.Migrations))
+			for i, m := range resp.Migrations {
+				rows[i] = []string{strconv.Itoa(m.Version), m.Name, strconv.FormatBool(m.Applied), strconv.FormatBool(m.Down != "")}
+			}
+			return printTable([]string{"VERSION", "NAME", "APPLIED", "REVERSIBLE"}, rows)
+		},
+	})
+
+	cmd.AddCommand(newMigrateCommand("apply", "/migrate", "Apply pending migrations (up to --to)"))
+	cmd.AddCommand(newMigrateCommand("rollback", "/rollback", "Roll back migrations (default: the latest one; down to --to)"))
+	return cmd
+}
+
+func newMigrateCommand(use, path, short string) *cobra.Command {
+	var target int
+	cmd := &cobra.Command{
+		Use:   use + " DB",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			body := map[string]interface{}{"dbname": args[0]}
+			if cmd.Flags().Changed("to") {
+				body["target"] = target
+			}
+			var resp map[string]interface{}
+			if err := call(http.MethodPost, path, nil, body, &resp); err != nil {
+				return err
+			}
+			return printMessage(resp)
+		},
+	}
+	cmd.Flags().IntVar(&target, "to", 0, "target version")
+	return cmd
+}
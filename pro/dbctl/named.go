@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func newNamedQueryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "named-query",
+		Aliases: []string{"nq"},
+		Short:   "Register, list, delete and run named queries",
+	}
+
+	var sqlText, description string
+	var params []string
+	add := &cobra.Command{
+		Use:   "add NAME",
+		Short: "Register or replace a named query (needs the admin token)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			body := map[string]interface{}{"name": args[0], "sql": sqlText, "params": params, "description": description}
+			var resp map[string]interface{}
+			if err := call(http.MethodPost, "/named-queries", nil, body, &resp); err != nil {
+				return err
+			}
+			return printMessage(resp)
+		},
+	}
+	add.Flags().StringVar(&sqlText, "sql", "", "the statement, with ? placeholders")
+	add.Flags().StringSliceVar(&params, "param", nil, "placeholder names in order, e.g. --param customer_id")
+	add.Flags().StringVar(&description, "description", "", "what the query is for")
+	add.MarkFlagRequired("sql")
+	cmd.AddCommand(add)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the registered named queries",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp struct {
+				Queries []struct {
+					Name        string   `json:"name"`
+					SQL         string   `json:"sql"`
+					Params      []string `json:"params"`
+					Description string   `json:"description,omitempty"`
+				} `json:"queries"`
+			}
+			if err := call(http.MethodGet, "/named-queries", nil, nil, &resp); err != nil {
+				return err
+			}
+			if outputFlag == "json" {
+				return printJSON(resp.Queries)
+			}
+			rows := make([][]string, len(resp.Queries))
+			for i, q := range resp.Queries {
+				rows[i] = []string{q.Name, strings.Join(q.Params, ", "), q.Description, q.SQL}
+			}
+			return printTable([]string{"NAME", "PARAMS", "DESCRIPTION", "SQL"}, rows)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "delete NAME",
+		Short: "Remove a named query (needs the admin token)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp map[string]interface{}
+			if err := call(http.MethodDelete, "/named-queries", url.Values{"name": {args[0]}}, nil, &resp); err != nil {
+				return err
+			}
+			return printMessage(resp)
+		},
+	})
+
+	var callArgs []string
+	run := &cobra.Command{
+		Use:   "run NAME",
+		Short: "Run a named query",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			values, err := parseAssignments(callArgs)
+			if err != nil {
+				return err
+			}
+			var raw json.RawMessage
+			if err := call(http.MethodPost, "/call", nil, map[string]interface{}{"name": args[0], "args": values}, &raw); err != nil {
+				return err
+			}
+			return printQueryResult(raw)
+		},
+	}
+	run.Flags().StringArrayVar(&callArgs, "arg", nil, "argument, e.g. --arg customer_id=42 (repeatable)")
+	cmd.AddCommand(run)
+	return cmd
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// runningQuery is one entry of a node's /running-queries response.
+type runningQuery struct {
+	ID        uint64 `json:"id"`
+	RequestID string `json:"requestId"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Seconds   int64  `json:"seconds"`
+	State     string `json:"state"`
+	SQL       string `json:"sql"`
+}
+
+func newQueriesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "queries",
+		Short: "List and kill the statements the nodes are running (needs the admin token)",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the running statements of every node",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			all := map[string]interface{}{}
+			var rows [][]string
+			for _, address := range nodes() {
+				var resp struct {
+					Queries []runningQuery `json:"queries"`
+				}
+				if err := callNode(address, http.MethodGet, "/running-queries", nil, nil, &resp); err != nil {
+					all[address] = map[string]string{"error": err.Error()}
+					rows = append(rows, []string{address, "", "", "error: " + err.Error(), "", "", ""})
+					continue
+				}
+				all[address] = resp.Queries
+				for _, q := range resp.Queries {
+					rows = append(rows, []string{
+						address,
+						strconv.FormatUint(q.ID, 10),
+						q.RequestID,
+						strings.TrimSpace(q.Method + " " + q.Path),
+						strconv.FormatInt(q.Seconds, 10) + "s",
+						q.State,
+						q.SQL,
+					})
+				}
+			}
+			if outputFlag == "json" {
+				return printJSON(all)
+			}
+			return printTable([]string{"NODE", "ID", "REQUEST", "ENDPOINT", "TIME", "STATE", "SQL"}, rows)
+		},
+	})
+
+	var requestID, node string
+	var id uint64
+	kill := &cobra.Command{
+		Use:   "kill",
+		Short: "Cancel a request on every node, or kill one statement of a node",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if requestID != "" {
+				cancelled := 0
+				var failed []string
+				for _, address := range nodes() {
+					var resp struct {
+						Cancelled int `json:"cancelled"`
+					}
+					err := callNode(address, http.MethodDelete, "/running-queries", url.Values{"requestId": {requestID}}, nil, &resp)
+					if err != nil && !strings.Contains(err.Error(), "404") {
+						failed = append(failed, err.Error())
+					}
+					cancelled += resp.Cancelled
+				}
+				if len(failed) > 0 {
+					return fmt.Errorf("kill failed on %d node(s): %s", len(failed), strings.Join(failed, "; "))
+				}
+				if cancelled == 0 {
+					return fmt.Errorf("no node is running request %s", requestID)
+				}
+				return printMessage(map[string]interface{}{"message": fmt.Sprintf("Cancelled %d request(s)", cancelled)})
+			}
+			if id == 0 || node == "" {
+				return errors.New("either --request, or --id with --node, is required")
+			}
+			var resp map[string]interface{}
+			query := url.Values{"id": {strconv.FormatUint(id, 10)}}
+			if err := callNode(strings.TrimRight(node, "/"), http.MethodDelete, "/running-queries", query, nil, &resp); err != nil {
+				return err
+			}
+			return printMessage(resp)
+		},
+	}
+	kill.Flags().StringVar(&requestID, "request", "", "request ID whose statements to cancel, on every node")
+	kill.Flags().Uint64Var(&id, "id", 0, "MySQL connection ID from 'queries list'")
+	kill.Flags().StringVar(&node, "node", "", "node running the statement given with --id")
+	cmd.AddCommand(kill)
+	return cmd
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+func newQueryCommand() *cobra.Command {
+	var params []string
+	var explainOnly bool
+	cmd := &cobra.Command{
+		Use:   "query SQL",
+		Short: "Run a SQL statement; reads print rows, writes go through the master",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			values := make([]interface{}, len(params))
+			for i, raw := range params {
+				if err := json.Unmarshal([]byte(raw), &values[i]); err != nil {
+					values[i] = raw
+				}
+			}
+			body := map[string]interface{}{"sql": args[0], "params": values}
+			if explainOnly {
+				return explain(body)
+			}
+
+			var raw json.RawMessage
+			if err := call(http.MethodPost, "/query", nil, body, &raw); err != nil {
+				return err
+			}
+			return printQueryResult(raw)
+		},
+	}
+	cmd.Flags().StringArrayVar(&params, "param", nil, "value bound to the next ? placeholder (repeatable)")
+	cmd.Flags().BoolVar(&explainOnly, "explain", false, "print the query plan of a read instead of running it")
+	return cmd
+}
+
+// printQueryResult prints the response of /query or /call: rows for a read,
+// the execution summary for a write.
+func printQueryResult(raw json.RawMessage) error {
+	var resp map[string]interface{}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return err
+	}
+	if resp["type"] != "read" {
+		return printMessage(resp)
+	}
+	var rs resultSet
+	if err := json.Unmarshal(raw, &rs); err != nil {
+		return err
+	}
+	return printResultSet(rs)
+}
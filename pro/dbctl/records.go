@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// parseAssignments turns col=value pairs into a column→value map. Values
+// that parse as JSON (numbers, true/false, null, quoted strings) keep their
+// type; anything else is sent as a string.
+func parseAssignments(pairs []string) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(pairs))
+	for _, pair := range pairs {
+		col, raw, ok := strings.Cut(pair, "=")
+		if !ok || col == "" {
+			return nil, fmt.Errorf("expected column=value, got %q", pair)
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(raw), &v); err != nil {
+			v = raw
+		}
+		values[col] = v
+	}
+	return values, nil
+}
+
+// whereFilter builds the structured filter for update and delete: either the
+// raw JSON given with --filter, or the --where col=value pairs ANDed together.
+func whereFilter(where []string, filterJSON string) (interface{}, error) {
+	if filterJSON != "" {
+		var f interface{}
+		if err := json.Unmarshal([]byte(filterJSON), &f); err != nil {
+			return nil, fmt.Errorf("invalid --filter: %w", err)
+		}
+		return f, nil
+	}
+	if len(where) == 0 {
+		return nil, errors.New("one of --where or --filter is required")
+	}
+
+	values, err := parseAssignments(where)
+	if err != nil {
+		return nil, err
+	}
+	var conds []map[string]interface{}
+	for col, v := range values {
+		conds = append(conds, map[string]interface{}{"column": col, "op": "eq", "value": v})
+	}
+	if len(conds) == 1 {
+		return conds[0], nil
+	}
+	return map[string]interface{}{"and": conds}, nil
+}
+
+func newInsertCommand() *cobra.Command {
+	var values []string
+	cmd := &cobra.Command{
+		Use:   "insert DB TABLE",
+		Short: "Insert a record",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			row, err := parseAssignments(values)
+			if err != nil {
+				return err
+			}
+			body := map[string]interface{}{"dbname": args[0], "table": args[1], "values": row}
+			var resp map[string]interface{}
+			if err := call(http.MethodPost, "/insert", nil, body, &resp); err != nil {
+				return err
+			}
+			return printMessage(resp)
+		},
+	}
+	cmd.Flags().StringArrayVar(&values, "value", nil, `column value, e.g. --value id=1 --value name=Ali (repeatable)`)
+	cmd.MarkFlagRequired("value")
+	return cmd
+}
+
+func newUpsertCommand() *cobra.Command {
+	var values, keys, update []string
+	cmd := &cobra.Command{
+		Use:   "upsert DB TABLE",
+		Short: "Insert a record, or update it if the key already exists",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			row, err := parseAssignments(values)
+			if err != nil {
+				return err
+			}
+			body := map[string]interface{}{
+				"dbname":       args[0],
+				"table":        args[1],
+				"values":       row,
+				"conflictKeys": keys,
+				"update":       update,
+			}
+			var resp map[string]interface{}
+			if err := call(http.MethodPost, "/upsert", nil, body, &resp); err != nil {
+				return err
+			}
+			return printMessage(resp)
+		},
+	}
+	cmd.Flags().StringArrayVar(&values, "value", nil, `column value, e.g. --value id=1 --value name=Ali (repeatable)`)
+	cmd.Flags().StringSliceVar(&keys, "key", nil, "conflict key columns (primary or unique key)")
+	cmd.Flags().StringSliceVar(&update, "update", nil, "columns to overwrite on conflict (default all non-key columns)")
+	cmd.MarkFlagRequired("value")
+	cmd.MarkFlagRequired("key")
+	return cmd
+}
+
+func newSelectCommand() *cobra.Command {
+	var columns, where, order []string
+	var filterJSON string
+	var limit, offset int
+	var count, streamRows, keyset, explainOnly bool
+	var cursor string
+	cmd := &cobra.Command{
+		Use:   "select DB TABLE",
+		Short: "Print the records of a table",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			body := map[string]interface{}{
+				"dbname":  args[0],
+				"table":   args[1],
+				"columns": columns,
+				"limit":   limit,
+				"offset":  offset,
+				"count":   count,
+				"keyset":  keyset,
+				"cursor":  cursor,
+			}
+			if len(where) > 0 || filterJSON != "" {
+				f, err := whereFilter(where, filterJSON)
+				if err != nil {
+					return err
+				}
+				body["where"] = f
+			}
+			var terms []map[string]interface{}
+			for _, col := range order {
+				terms = append(terms, map[string]interface{}{
+					"column": strings.TrimPrefix(col, "-"),
+					"desc":   strings.HasPrefix(col, "-"),
+				})
+			}
+			body["orderBy"] = terms
+
+			if explainOnly {
+				return explain(map[string]interface{}{"select": body})
+			}
+
+			if streamRows {
+				// Rows are printed as NDJSON while the server reads them.
+				body["stream"] = "ndjson"
+				return stream(os.Stdout, http.MethodPost, "/select", nil, body)
+			}
+
+			var rs resultSet
+			header, err := callWithHeader(http.MethodPost, "/select", nil, body, &rs)
+			if err != nil {
+				return err
+			}
+			if count && outputFlag == "table" {
+				defer fmt.Printf("(%s matching rows)\n", header.Get("X-Total-Count"))
+			}
+			if rs.NextCursor != "" && outputFlag == "table" {
+				defer fmt.Printf("(next page: --cursor %s)\n", rs.NextCursor)
+			}
+			return printResultSet(rs)
+		},
+	}
+	cmd.Flags().StringSliceVar(&columns, "columns", nil, "columns to return (default all)")
+	cmd.Flags().StringArrayVar(&where, "where", nil, `equality condition, e.g. --where id=1 (repeatable, ANDed)`)
+	cmd.Flags().StringVar(&filterJSON, "filter", "", `structured filter as JSON, e.g. '{"column":"age","op":"gt","value":30}'`)
+	cmd.Flags().StringSliceVar(&order, "order", nil, `sort columns, "-" prefix for descending, e.g. --order name,-id`)
+	cmd.Flags().IntVar(&limit, "limit", 0, "maximum number of rows")
+	cmd.Flags().IntVar(&offset, "offset", 0, "rows to skip")
+	cmd.Flags().BoolVar(&count, "count", false, "also report the total number of matching rows")
+	cmd.Flags().BoolVar(&streamRows, "stream", false, "stream rows as NDJSON instead of buffering a table")
+	cmd.Flags().BoolVar(&keyset, "keyset", false, "page by sort key (needs --limit); prints the cursor of the next page")
+	cmd.Flags().StringVar(&cursor, "cursor", "", "continue a keyset listing from the cursor printed by the previous page")
+	cmd.Flags().BoolVar(&explainOnly, "explain", false, "print the query plan instead of the records")
+	return cmd
+}
+
+func newUpdateCommand() *cobra.Command {
+	var set, where []string
+	var filterJSON string
+	var expectVersion uint64
+	cmd := &cobra.Command{
+		Use:   "update DB TABLE",
+		Short: "Update records",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			values, err := parseAssignments(set)
+			if err != nil {
+				return err
+			}
+			f, err := whereFilter(where, filterJSON)
+			if err != nil {
+				return err
+			}
+			body := map[string]interface{}{"dbname": args[0], "table": args[1], "set": values, "where": f}
+			if cmd.Flags().Changed("expect-version") {
+				body["expectedVersion"] = expectVersion
+			}
+			var resp map[string]interface{}
+			if err := call(http.MethodPost, "/update", nil, body, &resp); err != nil {
+				return err
+			}
+			return printMessage(resp)
+		},
+	}
+	cmd.Flags().StringArrayVar(&set, "set", nil, `new column value, e.g. --set name=Zaid (repeatable)`)
+	cmd.Flags().StringArrayVar(&where, "where", nil, `equality condition, e.g. --where id=1 (repeatable, ANDed)`)
+	cmd.Flags().StringVar(&filterJSON, "filter", "", `structured filter as JSON, e.g. '{"column":"id","op":"gt","value":10}'`)
+	cmd.Flags().Uint64Var(&expectVersion, "expect-version", 0, "update the single matching record only if its _version is still this (needs table versioning on)")
+	cmd.MarkFlagRequired("set")
+	return cmd
+}
+
+func newDeleteCommand() *cobra.Command {
+	var where []string
+	var filterJSON string
+	cmd := &cobra.Command{
+		Use:   "delete DB TABLE",
+		Short: "Delete records",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := whereFilter(where, filterJSON)
+			if err != nil {
+				return err
+			}
+			body := map[string]interface{}{"dbname": args[0], "table": args[1], "where": f}
+			var resp map[string]interface{}
+			if err := call(http.MethodPost, "/delete", nil, body, &resp); err != nil {
+				return err
+			}
+			return printMessage(resp)
+		},
+	}
+	cmd.Flags().StringArrayVar(&where, "where", nil, `equality condition, e.g. --where id=1 (repeatable, ANDed)`)
+	cmd.Flags().StringVar(&filterJSON, "filter", "", `structured filter as JSON`)
+	return cmd
+}
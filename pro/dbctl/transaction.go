@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func newTransactionCommand() *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:   "transaction -f FILE",
+		Short: "Run a batch of writes from a JSON file in one transaction",
+		Long: `Run a batch of writes atomically. FILE ("-" for stdin) holds a
+/transaction body, for example:
+
+  {"operations": [
+    {"op": "update", "dbname": "bank", "table": "accounts",
+     "set": {"balance": 50}, "where": {"column": "id", "op": "eq", "value": 1},
+     "expectRows": 1},
+    {"op": "insert", "dbname": "bank", "table": "ledger",
+     "values": {"account": 1, "amount": -50}}
+  ]}`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var data []byte
+			var err error
+			if file == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(file)
+			}
+			if err != nil {
+				return err
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(data, &body); err != nil {
+				return fmt.Errorf("invalid transaction file: %w", err)
+			}
+
+			var resp map[string]interface{}
+			if err := call(http.MethodPost, "/transaction", nil, body, &resp); err != nil {
+				return err
+			}
+			return printMessage(resp)
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", `transaction file, or "-" for stdin`)
+	cmd.MarkFlagRequired("file")
+	return cmd
+}
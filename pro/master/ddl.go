@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The table and index DDL endpoints take URL parameters, like /createtable,
+// and are replicated by replaying the same parameters on
+// /replicate/<endpoint>:
+//
+//	/altertable   dbname, table, action (add|drop|modify|rename), column,
+//	              definition (add, modify), after (add, modify), to (rename)
+//	/droptable    dbname, table
+//	/truncate     dbname, table
+//	/renametable  dbname, table, to
+//	/createindex  dbname, table, name, columns (comma-separated), unique
+//	/dropindex    dbname, table, name
+
+// ddlTable validates and quotes the dbname and table parameters.
+func ddlTable(q url.Values) (string, error) {
+	dbname, table := q.Get("dbname"), q.Get("table")
+	if dbname == "" || table == "" {
+		return "", errors.New("Both dbname and table parameters are required")
+	}
+	return writableTable(dbname, table)
+}
+
+// checkColumnDefinition rejects a column definition that would smuggle
+// further clauses or statements into an ALTER TABLE, e.g. "INT, DROP COLUMN x".
+func checkColumnDefinition(definition string) error {
+	tokens, err := tokenizeSQL(definition)
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if t.text == ";" || (t.text == "," && t.depth == 0) || t.depth < 0 {
+			return errors.New("Invalid column definition")
+		}
+	}
+	return nil
+}
+
+func buildAlterTable(q url.Values) (string, error) {
+	table, err := ddlTable(q)
+	if err != nil {
+		return "", err
+	}
+	if q.Get("column") == "" {
+		return "", errors.New("column parameter is required")
+	}
+	if strings.EqualFold(q.Get("column"), versionColumn) || strings.EqualFold(q.Get("to"), versionColumn) {
+		return "", errVersionColumn
+	}
+	column, err := quoteIdent(q.Get("column"))
+	if err != nil {
+		return "", err
+	}
+
+	position := ""
+	if after := q.Get("after"); after != "" {
+		col, err := quoteIdent(after)
+		if err != nil {
+			return "", err
+		}
+		position = " AFTER " + col
+	}
+
+	action := strings.ToLower(q.Get("action"))
+	switch action {
+	case "add", "modify":
+		definition := strings.TrimSpace(q.Get("definition"))
+		if definition == "" {
+			return "", fmt.Errorf("definition parameter is required to %s a column", action)
+		}
+		if err := checkColumnDefinition(definition); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ALTER TABLE %s %s COLUMN %s %s%s", table, strings.ToUpper(action), column, definition, position), nil
+	case "drop":
+		return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column), nil
+	case "rename":
+		if q.Get("to") == "" {
+			return "", errors.New("to parameter is required to rename a column")
+		}
+		to, err := quoteIdent(q.Get("to"))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", table, column, to), nil
+	}
+	return "", fmt.Errorf("unknown action %q (expected add, drop, modify or rename)", q.Get("action"))
+}
+
+func buildDropTable(q url.Values) (string, error) {
+	table, err := ddlTable(q)
+	if err != nil {
+		return "", err
+	}
+	// IF EXISTS keeps a retried replication from failing on a replica that
+	// already applied it.
+	return "DROP TABLE IF EXISTS " + table, nil
+}
+
+func buildTruncate(q url.Values) (string, error) {
+	table, err := ddlTable(q)
+	if err != nil {
+		return "", err
+	}
+	return "TRUNCATE TABLE " + table, nil
+}
+
+func buildRenameTable(q url.Values) (string, error) {
+	table, err := ddlTable(q)
+	if err != nil {
+		return "", err
+	}
+	if q.Get("to") == "" {
+		return "", errors.New("to parameter is required")
+	}
+	to, err := writableTable(q.Get("dbname"), q.Get("to"))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("RENAME TABLE %s TO %s", table, to), nil
+}
+
+func buildCreateIndex(q url.Values) (string, error) {
+	table, err := ddlTable(q)
+	if err != nil {
+		return "", err
+	}
+	if q.Get("name") == "" || q.Get("columns") == "" {
+		return "", errors.New("Both name and columns parameters are required")
+	}
+	name, err := quoteIdent(q.Get("name"))
+	if err != nil {
+		return "", err
+	}
+	var cols []string
+	for _, c := range strings.Split(q.Get("columns"), ",") {
+		col, err := quoteIdent(strings.TrimSpace(c))
+		if err != nil {
+			return "", err
+		}
+		cols = append(cols, col)
+	}
+
+	kind := "INDEX"
+	if v := q.Get("unique"); v != "" {
+		unique, err := strconv.ParseBool(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid unique %q", v)
+		}
+		if unique {
+			kind = "UNIQUE INDEX"
+		}
+	}
+	return fmt.Sprintf("CREATE %s %s ON %s (%s)", kind, name, table, strings.Join(cols, ", ")), nil
+}
+
+func buildDropIndex(q url.Values) (string, error) {
+	table, err := ddlTable(q)
+	if err != nil {
+		return "", err
+	}
+	if q.Get("name") == "" {
+		return "", errors.New("name parameter is required")
+	}
+	name, err := quoteIdent(q.Get("name"))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("DROP INDEX %s ON %s", name, table), nil
+}
+
+// execDDL builds a statement from the request parameters, runs it, and, when
+// replicatePath is set, replays the same parameters on the slaves.
+func execDDL(w http.ResponseWriter, r *http.Request, build func(url.Values) (string, error), message, replicatePath string) {
+	q := r.URL.Query()
+	query, err := build(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := dbExec(detachWrite(r.Context()), query); err != nil {
+		http.Error(w, "Failed to run "+strings.Fields(query)[0]+": "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resultCache.invalidate(q.Get("dbname"), q.Get("table"))
+	if to := q.Get("to"); to != "" && q.Get("action") == "" {
+		// RENAME TABLE: results may be cached under the new name from a
+		// table that had it before.
+		resultCache.invalidate(q.Get("dbname"), to)
+	}
+
+	if replicatePath != "" {
+		replicateToSlaves(r.Context(), replicatePath+"?"+q.Encode())
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+func alterTable(w http.ResponseWriter, r *http.Request) {
+	execDDL(w, r, buildAlterTable, "Table altered successfully", "/replicate/altertable")
+}
+
+func dropTable(w http.ResponseWriter, r *http.Request) {
+	execDDL(w, r, buildDropTable, "Table dropped successfully", "/replicate/droptable")
+}
+
+func truncateTable(w http.ResponseWriter, r *http.Request) {
+	execDDL(w, r, buildTruncate, "Table truncated successfully", "/replicate/truncate")
+}
+
+func renameTable(w http.ResponseWriter, r *http.Request) {
+	execDDL(w, r, buildRenameTable, "Table renamed successfully", "/replicate/renametable")
+}
+
+func createIndex(w http.ResponseWriter, r *http.Request) {
+	execDDL(w, r, buildCreateIndex, "Index created successfully", "/replicate/createindex")
+}
+
+func dropIndex(w http.ResponseWriter, r *http.Request) {
+	execDDL(w, r, buildDropIndex, "Index dropped successfully", "/replicate/dropindex")
+}
+
+func replicateAlterTable(w http.ResponseWriter, r *http.Request) {
+	execDDL(w, r, buildAlterTable, "Table altered successfully", "")
+}
+
+func replicateDropTable(w http.ResponseWriter, r *http.Request) {
+	execDDL(w, r, buildDropTable, "Table dropped successfully", "")
+}
+
+func replicateTruncate(w http.ResponseWriter, r *http.Request) {
+	execDDL(w, r, buildTruncate, "Table truncated successfully", "")
+}
+
+func replicateRenameTable(w http.ResponseWriter, r *http.Request) {
+	execDDL(w, r, buildRenameTable, "Table renamed successfully", "")
+}
+
+func replicateCreateIndex(w http.ResponseWriter, r *http.Request) {
+	execDDL(w, r, buildCreateIndex, "Index created successfully", "")
+}
+
+func replicateDropIndex(w http.ResponseWriter, r *http.Request) {
+	execDDL(w, r, buildDropIndex, "Index dropped successfully", "")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// livez reports that the process is up and serving HTTP. It says nothing
+// about MySQL; use readyz for that.
+func livez(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// readyz reports whether this node can serve traffic: MySQL must answer a ping
+// and the node must not be shutting down. The body describes the node's role
+// and replication state; the status code is 200 when ready and 503 otherwise.
+func readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	ready := true
+	mysqlStatus := "ok"
+	if err := db.PingContext(ctx); err != nil {
+		ready = false
+		mysqlStatus = err.Error()
+	}
+	if shuttingDown.Load() {
+		ready = false
+	}
+
+	master, address, slaves := leaderState()
+	role := "slave"
+	if master {
+		role = "master"
+	}
+	status := "ready"
+	code := http.StatusOK
+	if !ready {
+		status = "not ready"
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":       status,
+		"role":         role,
+		"master":       address,
+		"mysql":        mysqlStatus,
+		"shuttingDown": shuttingDown.Load(),
+		"replication": map[string]interface{}{
+			"slaves":    slaves,
+			"pending":   pendingReplicationCount(),
+			"delivered": replicationDelivered.Load(),
+			"failed":    replicationFailed.Load(),
+		},
+	})
+}
+
+// checkReady queries address's readiness endpoint and returns an error if the
+// node is unreachable or not ready.
+func checkReady(address string) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(address + "/readyz")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("node not ready: %s", resp.Status)
+	}
+	return nil
+}
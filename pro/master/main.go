@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,7 +21,8 @@ import (
 func allowCORS(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, X-Request-Timeout, If-Match")
+	w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, X-Total-Count, X-Cache, ETag")
 }
 
 var db *sql.DB
@@ -27,16 +32,30 @@ var masterAddress string = "http://localhost:8001"
 var electionInProgress bool = false
 
 func main() {
-	var err error
-	db, err = sql.Open("mysql", "root:rootroot@tcp(127.0.0.1:3306)/")
+	setupLogging("master")
+
+	shutdownTracing, err := setupTracing(context.Background(), "master")
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
+	db, err = sql.Open("mysql", "root:rootroot@tcp(127.0.0.1:3306)/"+dsnParams)
+	if err != nil {
+		slog.Error("Failed to open database connection", "error", err)
+		os.Exit(1)
 	}
-	defer db.Close()
 
 	err = db.Ping()
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		slog.Error("Failed to connect to database", "error", err)
+		os.Exit(1)
+	}
+
+	if err := ensureClusterSchema(context.Background()); err != nil {
+		slog.Error("Failed to create cluster metadata schema", "error", err)
+		os.Exit(1)
 	}
 
 	// Define routes
@@ -46,11 +65,21 @@ func main() {
 		w.Write([]byte("pong"))
 	})
 
+	http.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		livez(w, r)
+	})
+
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		readyz(w, r)
+	})
+
 	http.HandleFunc("/is-master", func(w http.ResponseWriter, r *http.Request) {
 		allowCORS(w)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]bool{
-			"isMaster": isMaster,
+			"isMaster": nodeIsMaster(),
 		})
 	})
 
@@ -81,6 +110,96 @@ func main() {
 		createTable(w, r)
 	})
 
+	http.HandleFunc("/altertable", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		alterTable(w, r)
+	})
+
+	http.HandleFunc("/droptable", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		dropTable(w, r)
+	})
+
+	http.HandleFunc("/truncate", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		truncateTable(w, r)
+	})
+
+	http.HandleFunc("/renametable", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		renameTable(w, r)
+	})
+
+	http.HandleFunc("/createindex", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		createIndex(w, r)
+	})
+
+	http.HandleFunc("/dropindex", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		dropIndex(w, r)
+	})
+
+	http.HandleFunc("/versioning", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		manageVersioning(w, r, "/replicate/versioning")
+	})
+
+	http.HandleFunc("/migrations", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		manageMigrations(w, r)
+	})
+
+	http.HandleFunc("/migrate", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		migrate(w, r)
+	})
+
+	http.HandleFunc("/rollback", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		rollbackMigrations(w, r)
+	})
+
 	http.HandleFunc("/insert", func(w http.ResponseWriter, r *http.Request) {
 		allowCORS(w)
 		if r.Method == http.MethodOptions {
@@ -90,11 +209,159 @@ func main() {
 		insertRecord(w, r)
 	})
 
+	http.HandleFunc("/upsert", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		upsertRecord(w, r)
+	})
+
+	http.HandleFunc("/transaction", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		runTransactionBatch(w, r)
+	})
+
+	http.HandleFunc("/schema-versions", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		listSchemaVersions(w, r)
+	})
+
+	http.HandleFunc("/databases", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		listDatabases(w, r)
+	})
+
+	http.HandleFunc("/tables", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		listTables(w, r)
+	})
+
+	http.HandleFunc("/describe", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		describe(w, r)
+	})
+
+	http.HandleFunc("/export", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		exportTable(w, r)
+	})
+
+	http.HandleFunc("/cache", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		cacheStatus(w, r)
+	})
+
+	http.HandleFunc("/running-queries", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		manageRunningQueries(w, r)
+	})
+
+	http.HandleFunc("/query", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		runQuery(w, r)
+	})
+
+	http.HandleFunc("/explain", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		explainQuery(w, r)
+	})
+
+	http.HandleFunc("/named-queries", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		manageNamedQueries(w, r)
+	})
+
+	http.HandleFunc("/call", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		callNamedQuery(w, r)
+	})
+
+	http.HandleFunc("/bulk-insert", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		bulkInsert(w, r)
+	})
+
+	http.HandleFunc("/import", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		importCSV(w, r)
+	})
+
 	http.HandleFunc("/select", func(w http.ResponseWriter, r *http.Request) {
 		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
 		selectRecords(w, r)
 	})
 
+	http.HandleFunc("/aggregate", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		aggregateRecords(w, r)
+	})
+
 	http.HandleFunc("/update", func(w http.ResponseWriter, r *http.Request) {
 		allowCORS(w)
 		if r.Method == http.MethodOptions {
@@ -113,9 +380,43 @@ func main() {
 		deleteRecord(w, r)
 	})
 
+	http.HandleFunc("/promote", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		promote(w, r)
+	})
+
+	http.HandleFunc("/follow", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		followMaster(w, r)
+	})
+
+	// After handing off leadership, a restarted master follows its successor.
+	if addr := findMaster(slaveAddresses); addr != "" {
+		stepDown(addr)
+		slog.Warn("Another node is the master; starting as a follower", "master", addr)
+		if err := checkSchemaVersions(context.Background(), addr); errors.Is(err, errSchemaMismatch) {
+			slog.Error("Schema version differs from the leader; apply or roll back migrations first", "master", addr, "error", err)
+			os.Exit(1)
+		} else if err != nil {
+			slog.Warn("Could not compare schema versions with the leader", "master", addr, "error", err)
+		}
+	}
+
+	resumePendingReplication()
 	go checkMasterHealth()
-	fmt.Println("Master server running on port 8001...")
-	log.Fatal(http.ListenAndServe(":8001", nil))
+	slog.Info("Master server running", "addr", ":8001")
+	if err := serve(":8001", instrument(http.DefaultServeMux)); err != nil {
+		slog.Error("HTTP server stopped", "error", err)
+		os.Exit(1)
+	}
 }
 
 func createDB(w http.ResponseWriter, r *http.Request) {
@@ -125,13 +426,13 @@ func createDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := db.Exec("CREATE DATABASE IF NOT EXISTS " + dbname)
+	_, err := dbExec(detachWrite(r.Context()), "CREATE DATABASE IF NOT EXISTS " + dbname)
 	if err != nil {
 		http.Error(w, "Failed to create database: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	go replicateToSlaves("/replicate/db?name=" + dbname)
+	replicateToSlaves(r.Context(), "/replicate/db?name=" + dbname)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Database created successfully"})
 }
@@ -142,14 +443,19 @@ func dropDB(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Database name is required", http.StatusBadRequest)
 		return
 	}
+	if err := writableSchema(dbname); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	_, err := db.Exec("DROP DATABASE IF EXISTS " + dbname)
+	_, err := dbExec(detachWrite(r.Context()), "DROP DATABASE IF EXISTS " + dbname)
 	if err != nil {
 		http.Error(w, "Failed to drop database: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	go replicateToSlaves("/replicate/dropdb?name=" + dbname)
+	resultCache.invalidateDatabase(dbname)
+	replicateToSlaves(r.Context(), "/replicate/dropdb?name=" + dbname)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Database dropped successfully"})
 }
@@ -163,241 +469,264 @@ func createTable(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "All parameters (dbname, table, schema) are required", http.StatusBadRequest)
 		return
 	}
+	if _, err := writableTable(dbname, table); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s.%s (%s)", dbname, table, schema)
-	_, err := db.Exec(query)
+	_, err := dbExec(detachWrite(r.Context()), query)
 	if err != nil {
 		http.Error(w, "Failed to create table: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	go replicateToSlaves(fmt.Sprintf("/replicate/table?dbname=%s&table=%s&schema=%s",
+	replicateToSlaves(r.Context(), fmt.Sprintf("/replicate/table?dbname=%s&table=%s&schema=%s",
 		dbname, table, url.QueryEscape(schema)))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Table created successfully"})
 }
 
 func insertRecord(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		DBName string `json:"dbname"`
-		Table  string `json:"table"`
-		Values string `json:"values"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	var req insertRequest
+	if err := decodeJSON(r, &req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.DBName == "" || req.Table == "" || req.Values == "" {
-		http.Error(w, "All fields (dbname, table, values) are required", http.StatusBadRequest)
+	query, args, err := buildInsert(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	query := fmt.Sprintf("INSERT INTO %s.%s VALUES (%s)", req.DBName, req.Table, req.Values)
-	_, err := db.Exec(query)
+	result, err := dbExec(detachWrite(r.Context()), query, args...)
 	if err != nil {
 		http.Error(w, "Failed to insert record: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	go replicateToSlavesJSON("/replicate/insert", req)
+	resultCache.invalidate(req.DBName, req.Table)
+	replicateToSlavesJSON(r.Context(), "/replicate/insert", req)
+	rowsAffected, _ := result.RowsAffected()
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Record inserted successfully"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Record inserted successfully",
+		"rowsAffected": rowsAffected,
+	})
 }
 
 func selectRecords(w http.ResponseWriter, r *http.Request) {
-	dbname := r.URL.Query().Get("dbname")
-	table := r.URL.Query().Get("table")
-
-	if dbname == "" || table == "" {
-		http.Error(w, "Both dbname and table parameters are required", http.StatusBadRequest)
+	req, err := parseSelectRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	query := fmt.Sprintf("SELECT * FROM %s.%s", dbname, table)
-	rows, err := db.Query(query)
+	var page *keysetPage
+	if req.Keyset || req.Cursor != "" {
+		var status int
+		if page, status, err = newKeysetPage(r.Context(), req); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+
+	query, args, err := buildSelect(req)
+	if page != nil {
+		query, args, err = page.buildSelect(req)
+	}
 	if err != nil {
-		http.Error(w, "Failed to query records: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
 
-	cols, err := rows.Columns()
-	if err != nil {
-		http.Error(w, "Failed to get columns: "+err.Error(), http.StatusInternalServerError)
+	key := selectCacheKey(query, args, req.Count)
+	if req.Stream == "" && serveCachedSelect(w, r, key) {
 		return
 	}
+	// Streams are never cached.
+	var sources []string
+	if req.Stream == "" {
+		sources = resultCache.sources(r.Context(), req.DBName, req.Table)
+	}
+	version := resultCache.version(sources)
 
-	var results []map[string]interface{}
-	for rows.Next() {
-		columns := make([]interface{}, len(cols))
-		columnPointers := make([]interface{}, len(cols))
-		for i := range columns {
-			columnPointers[i] = &columns[i]
+	if req.Count {
+		countQuery, countArgs, _ := buildCount(req)
+		var total int64
+		if err := dbQueryRow(r.Context(), countQuery, countArgs...).Scan(&total); err != nil {
+			http.Error(w, "Failed to count records: "+err.Error(), http.StatusInternalServerError)
+			return
 		}
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+
+	if req.Stream != "" {
+		streamRecords(w, r, req.Stream, query, args)
+		return
+	}
+
+	rows, err := dbQuery(r.Context(), query, args...)
+	if err != nil {
+		http.Error(w, "Failed to query records: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
 
-		if err := rows.Scan(columnPointers...); err != nil {
-			http.Error(w, "Failed to scan row: "+err.Error(), http.StatusInternalServerError)
+	response := map[string]interface{}{}
+	if page != nil {
+		columns, results, next, err := page.scan(rows, req.Limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-
-		row := make(map[string]interface{})
-		for i, col := range cols {
-			val := columnPointers[i].(*interface{})
-			row[col] = *val
+		response["columns"], response["rows"] = columns, results
+		if etag := rowETag(results); etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		response["nextCursor"] = nil
+		if next != "" {
+			response["nextCursor"] = next
+		}
+	} else {
+		columns, results, err := scanResult(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response["columns"], response["rows"] = columns, results
+		if etag := rowETag(results); etag != "" {
+			w.Header().Set("ETag", etag)
 		}
-		results = append(results, row)
 	}
 
-	if err := rows.Err(); err != nil {
-		http.Error(w, "Error during rows iteration: "+err.Error(), http.StatusInternalServerError)
+	data, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Failed to encode result: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	data = append(data, '\n')
+	resultCache.put(key, sources, version, w.Header(), data)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(data)
 }
 
 func updateRecord(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		DBName string `json:"dbname"`
-		Table  string `json:"table"`
-		Set    string `json:"set"`
-		Where  string `json:"where"`
+	var req updateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	expected, err := expectedVersion(r, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if expected != nil {
+		updateIfVersion(w, r, req, *expected)
 		return
 	}
 
-	if req.DBName == "" || req.Table == "" || req.Set == "" || req.Where == "" {
-		http.Error(w, "All fields (dbname, table, set, where) are required", http.StatusBadRequest)
+	query, args, err := buildUpdate(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	query := fmt.Sprintf("UPDATE %s.%s SET %s WHERE %s", req.DBName, req.Table, req.Set, req.Where)
-	_, err := db.Exec(query)
+	result, err := dbExec(detachWrite(r.Context()), query, args...)
 	if err != nil {
 		http.Error(w, "Failed to update record: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	go replicateToSlavesJSON("/replicate/update", req)
+	resultCache.invalidate(req.DBName, req.Table)
+	replicateToSlavesJSON(r.Context(), "/replicate/update", req)
+	rowsAffected, _ := result.RowsAffected()
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Record updated successfully"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Record updated successfully",
+		"rowsAffected": rowsAffected,
+	})
 }
 
 func deleteRecord(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		DBName string `json:"dbname"`
-		Table  string `json:"table"`
-		Where  string `json:"where"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	var req deleteRequest
+	if err := decodeJSON(r, &req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.DBName == "" || req.Table == "" || req.Where == "" {
-		http.Error(w, "All fields (dbname, table, where) are required", http.StatusBadRequest)
+	query, args, err := buildDelete(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	query := fmt.Sprintf("DELETE FROM %s.%s WHERE %s", req.DBName, req.Table, req.Where)
-	_, err := db.Exec(query)
+	result, err := dbExec(detachWrite(r.Context()), query, args...)
 	if err != nil {
 		http.Error(w, "Failed to delete record: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	go replicateToSlavesJSON("/replicate/delete", req)
+	resultCache.invalidate(req.DBName, req.Table)
+	replicateToSlavesJSON(r.Context(), "/replicate/delete", req)
+	rowsAffected, _ := result.RowsAffected()
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Record deleted successfully"})
-}
-
-func replicateToSlaves(path string) {
-	for _, addr := range slaveAddresses {
-		go func(address string) {
-			maxRetries := 3
-			retryDelay := 2 * time.Second
-
-			for i := 0; i < maxRetries; i++ {
-				client := &http.Client{Timeout: 5 * time.Second}
-				resp, err := client.Get(address + path)
-				if err == nil {
-					defer resp.Body.Close()
-					if resp.StatusCode == http.StatusOK {
-						log.Printf("Replication to %s succeeded", address)
-						return
-					}
-				}
-
-				if i < maxRetries-1 {
-					log.Printf("Attempt %d failed for %s, retrying in %v...", i+1, address, retryDelay)
-					time.Sleep(retryDelay)
-					retryDelay *= 2
-				}
-			}
-			log.Printf("Failed to replicate to %s after %d attempts", address, maxRetries)
-		}(addr)
-	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Record deleted successfully",
+		"rowsAffected": rowsAffected,
+	})
 }
 
-func replicateToSlavesJSON(path string, data interface{}) {
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		log.Printf("Failed to marshal data for replication: %v", err)
+func startElection() {
+	if !beginElection() {
 		return
 	}
 
-	for _, addr := range slaveAddresses {
-		go func(address string) {
-			maxRetries := 3
-			retryDelay := 2 * time.Second
-
-			for i := 0; i < maxRetries; i++ {
-				client := &http.Client{Timeout: 5 * time.Second}
-				resp, err := client.Post(address+path, "application/json", strings.NewReader(string(jsonData)))
-				if err == nil {
-					defer resp.Body.Close()
-					if resp.StatusCode == http.StatusOK {
-						log.Printf("Replication to %s succeeded", address)
-						return
-					}
-				}
-
-				if i < maxRetries-1 {
-					log.Printf("Attempt %d failed for %s, retrying in %v...", i+1, address, retryDelay)
-					time.Sleep(retryDelay)
-					retryDelay *= 2
-				}
-			}
-			log.Printf("Failed to replicate to %s after %d attempts", address, maxRetries)
-		}(addr)
+	slog.Info("Starting master election")
+	time.Sleep(time.Second * 2)
+
+	if strings.HasSuffix(currentMaster(), "8001") {
+		promoteToMaster()
 	}
 }
 
-func startElection() {
-	if electionInProgress {
+func promoteToMaster() {
+	address := "http://localhost:8001"
+	if !claimMaster(address) {
 		return
 	}
-	electionInProgress = true
+	slog.Info("This node has been promoted to master", "address", address)
+}
 
-	log.Println("Starting master election...")
-	time.Sleep(time.Second * 2)
+// promote makes this node the master on request, e.g. when the current
+// master hands off leadership while shutting down and sends its slaves and
+// unfinished replication along.
+func promote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	if strings.HasSuffix(masterAddress, "8001") {
-		promoteToMaster()
+	req, err := decodePromoteRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
-}
 
-func promoteToMaster() {
-	isMaster = true
-	masterAddress = "http://localhost:8001"
-	log.Println("This node has been promoted to master")
+	promoteToMaster()
+	endElection()
+	req.takeOver(r)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Node promoted to master",
+		"master":  currentMaster(),
+	})
 }
 
 func checkMasterHealth() {
@@ -405,11 +734,9 @@ func checkMasterHealth() {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		if !isMaster {
-			client := &http.Client{Timeout: 5 * time.Second}
-			_, err := client.Get(masterAddress + "/ping")
-			if err != nil {
-				log.Printf("Master is down: %v", err)
+		if master, address, _ := leaderState(); !master {
+			if err := checkReady(address); err != nil {
+				slog.Warn("Master is down", "master", address, "error", err)
 				startElection()
 			}
 		}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// errNamedQueryNotFound is returned by loadNamedQuery for an unknown name.
+var errNamedQueryNotFound = errors.New("Named query not found")
+
+// namedQuery is a registered, parameterized statement, e.g.
+//
+//	{"name": "orders_by_customer", "params": ["customer_id"],
+//	 "sql": "SELECT * FROM shop.orders WHERE customer_id = ?"}
+//
+// Params name the ? placeholders of SQL in order. Like /query, table names
+// must be qualified with their database.
+type namedQuery struct {
+	Name        string   `json:"name"`
+	SQL         string   `json:"sql"`
+	Params      []string `json:"params"`
+	Description string   `json:"description,omitempty"`
+}
+
+// validate checks the query's fields and that its statement is a read or
+// DML with one placeholder per parameter. Schema changes belong in
+// migrations.
+func (q namedQuery) validate() error {
+	if q.Name == "" || strings.TrimSpace(q.SQL) == "" {
+		return errors.New("Both name and sql are required")
+	}
+	if !identifierPattern.MatchString(q.Name) {
+		return fmt.Errorf("invalid name %q", q.Name)
+	}
+	seen := map[string]bool{}
+	for _, p := range q.Params {
+		if !identifierPattern.MatchString(p) {
+			return fmt.Errorf("invalid parameter name %q", p)
+		}
+		if seen[p] {
+			return fmt.Errorf("duplicate parameter %q", p)
+		}
+		seen[p] = true
+	}
+	kind, placeholders, err := classifySQL(q.SQL)
+	if err != nil {
+		return err
+	}
+	if kind == statementDDL {
+		return errors.New("DDL statements are not allowed; use a migration")
+	}
+	if placeholders != len(q.Params) {
+		return fmt.Errorf("statement has %d placeholders but %d params were declared", placeholders, len(q.Params))
+	}
+	return nil
+}
+
+// bind orders args by the query's parameters.
+func (q namedQuery) bind(args map[string]interface{}) (sqlRequest, error) {
+	req := sqlRequest{SQL: q.SQL, Params: make([]interface{}, len(q.Params))}
+	for i, p := range q.Params {
+		v, ok := args[p]
+		if !ok {
+			return req, fmt.Errorf("missing argument %q", p)
+		}
+		req.Params[i] = v
+	}
+	if len(args) > len(q.Params) {
+		for name := range args {
+			if !q.hasParam(name) {
+				return req, fmt.Errorf("unknown argument %q", name)
+			}
+		}
+	}
+	return req, nil
+}
+
+func (q namedQuery) hasParam(name string) bool {
+	for _, p := range q.Params {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+func loadNamedQuery(ctx context.Context, name string) (namedQuery, error) {
+	q := namedQuery{Name: name}
+	var params string
+	err := dbQueryRow(ctx, "SELECT sql_text, params, description FROM `"+clusterSchema+"`.`named_queries` WHERE name = ?", name).
+		Scan(&q.SQL, &params, &q.Description)
+	if err == sql.ErrNoRows {
+		return q, errNamedQueryNotFound
+	}
+	if err != nil {
+		return q, err
+	}
+	return q, json.Unmarshal([]byte(params), &q.Params)
+}
+
+func loadNamedQueries(ctx context.Context) ([]namedQuery, error) {
+	rows, err := dbQuery(ctx, "SELECT name, sql_text, params, description FROM `"+clusterSchema+"`.`named_queries` ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	queries := []namedQuery{}
+	for rows.Next() {
+		var q namedQuery
+		var params string
+		if err := rows.Scan(&q.Name, &q.SQL, &params, &q.Description); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(params), &q.Params); err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	return queries, rows.Err()
+}
+
+func saveNamedQuery(ctx context.Context, q namedQuery) error {
+	params, err := json.Marshal(q.Params)
+	if err != nil {
+		return err
+	}
+	_, err = dbExec(ctx, "INSERT INTO `"+clusterSchema+"`.`named_queries` (name, sql_text, params, description) VALUES (?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE sql_text = VALUES(sql_text), params = VALUES(params), description = VALUES(description)",
+		q.Name, q.SQL, string(params), q.Description)
+	return err
+}
+
+func deleteNamedQuery(ctx context.Context, name string) (bool, error) {
+	result, err := dbExec(ctx, "DELETE FROM `"+clusterSchema+"`.`named_queries` WHERE name = ?", name)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// manageNamedQueries lists the registry on GET, registers or replaces a
+// query on POST and removes one on DELETE (?name=). Changes need the admin
+// token, are accepted by the master only and are replicated to the slaves.
+func manageNamedQueries(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		queries, err := loadNamedQueries(r.Context())
+		if err != nil {
+			http.Error(w, "Failed to load named queries: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"queries": queries})
+		return
+	case http.MethodPost, http.MethodDelete:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	if !nodeIsMaster() {
+		http.Error(w, "This node is not the master", http.StatusServiceUnavailable)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "name parameter is required", http.StatusBadRequest)
+			return
+		}
+		found, err := deleteNamedQuery(detachWrite(r.Context()), name)
+		if err != nil {
+			http.Error(w, "Failed to delete named query: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, errNamedQueryNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		replicateToSlaves(r.Context(), "/replicate/drop-named-query?"+url.Values{"name": {name}}.Encode())
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Named query deleted successfully"})
+		return
+	}
+
+	var q namedQuery
+	if err := decodeJSON(r, &q); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if q.Params == nil {
+		q.Params = []string{}
+	}
+	if err := q.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := saveNamedQuery(detachWrite(r.Context()), q); err != nil {
+		http.Error(w, "Failed to register named query: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	replicateToSlavesJSON(r.Context(), "/replicate/named-queries", q)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Named query registered successfully"})
+}
+
+// callRequest is the body of /call.
+type callRequest struct {
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// callNamedQuery runs a registered query with the given arguments. It is
+// open to every client, also when ADMIN_TOKEN restricts /query. Reads run on
+// this node and writes on the master, exactly as through /query.
+func callNamedQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var call callRequest
+	if err := decodeJSON(r, &call); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if call.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	q, err := loadNamedQuery(r.Context(), call.Name)
+	if err == errNamedQueryNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load named query: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req, err := q.bind(call.Args)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	runStatement(w, r, req, body)
+}
+
+func replicateNamedQuery(w http.ResponseWriter, r *http.Request) {
+	var q namedQuery
+	if err := decodeJSON(r, &q); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := q.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := saveNamedQuery(r.Context(), q); err != nil {
+		http.Error(w, "Failed to register named query: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Named query registered successfully"})
+}
+
+func replicateDropNamedQuery(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name parameter is required", http.StatusBadRequest)
+		return
+	}
+	// A query that is already gone is not an error on a replica.
+	if _, err := deleteNamedQuery(r.Context(), name); err != nil {
+		http.Error(w, "Failed to delete named query: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Named query deleted successfully"})
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errCursorMismatch is returned for a cursor issued for a different query.
+var errCursorMismatch = errors.New("cursor does not belong to this query")
+
+// cursorState is the content of an opaque /select cursor: the sort key of
+// the last row returned and a fingerprint of the query it belongs to. It
+// holds no server state, so any node can continue the listing, including
+// after a failover.
+type cursorState struct {
+	Query string   `json:"q"`
+	Keys  [][]byte `json:"k"` // text form of each sort key value
+}
+
+// keysetPage pages through a select by its sort key instead of an offset.
+// The sort key is the requested order followed by the primary key, so it is
+// unique and every row is returned exactly once while the table changes.
+type keysetPage struct {
+	order       []orderBy
+	extra       []string // key columns selected only to build the next cursor
+	after       [][]byte // sort key of the last row of the previous page
+	fingerprint string
+}
+
+// newKeysetPage prepares keyset pagination for req, decoding req.Cursor if
+// set. The returned status is the HTTP status for a non-nil error.
+func newKeysetPage(ctx context.Context, req selectRequest) (*keysetPage, int, error) {
+	if req.Limit <= 0 {
+		return nil, http.StatusBadRequest, errors.New("keyset pagination requires a limit")
+	}
+	if req.Offset > 0 {
+		return nil, http.StatusBadRequest, errors.New("offset cannot be combined with keyset pagination")
+	}
+	if req.Stream != "" {
+		return nil, http.StatusBadRequest, errors.New("stream cannot be combined with keyset pagination")
+	}
+	if _, err := qualifiedTable(req.DBName, req.Table); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	desc, err := describeTable(ctx, req.DBName, req.Table)
+	if err == errTableNotFound {
+		return nil, http.StatusNotFound, err
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Failed to describe table: %v", err)
+	}
+	if len(desc.PrimaryKey) == 0 {
+		return nil, http.StatusBadRequest, errors.New("keyset pagination requires a table with a primary key")
+	}
+
+	page := &keysetPage{}
+	ordered := map[string]bool{}
+	for _, term := range req.OrderBy {
+		col := findColumn(desc.Columns, term.Column)
+		if col == nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("unknown column %q", term.Column)
+		}
+		// MySQL sorts NULLs first, which a key comparison cannot express.
+		if col.Nullable {
+			return nil, http.StatusBadRequest, fmt.Errorf("column %q is nullable; keyset pagination needs NOT NULL sort columns", col.Name)
+		}
+		if !ordered[col.Name] {
+			ordered[col.Name] = true
+			page.order = append(page.order, orderBy{Column: col.Name, Desc: term.Desc})
+		}
+	}
+	for _, pk := range desc.PrimaryKey {
+		if !ordered[pk] {
+			ordered[pk] = true
+			page.order = append(page.order, orderBy{Column: pk})
+		}
+	}
+	if len(req.Columns) > 0 {
+		for _, term := range page.order {
+			if !containsFold(req.Columns, term.Column) {
+				page.extra = append(page.extra, term.Column)
+			}
+		}
+	}
+
+	where, _ := json.Marshal(req.Where)
+	order, _ := json.Marshal(page.order)
+	sum := sha256.Sum256([]byte(req.DBName + "\x00" + req.Table + "\x00" + string(where) + "\x00" + string(order)))
+	page.fingerprint = hex.EncodeToString(sum[:8])
+
+	if req.Cursor != "" {
+		if err := page.resume(req.Cursor); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+	}
+	return page, 0, nil
+}
+
+// cursor encodes the cursor of the page that follows the row with sort key
+// keys.
+func (p *keysetPage) cursor(keys [][]byte) (string, error) {
+	data, err := json.Marshal(cursorState{Query: p.fingerprint, Keys: keys})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// resume decodes a cursor issued by cursor and continues the listing after
+// the row it names.
+func (p *keysetPage) resume(cursor string) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+	var state cursorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return errors.New("invalid cursor")
+	}
+	if state.Query != p.fingerprint || len(state.Keys) != len(p.order) {
+		return errCursorMismatch
+	}
+	p.after = state.Keys
+	return nil
+}
+
+func findColumn(columns []schemaColumn, name string) *schemaColumn {
+	for i := range columns {
+		if strings.EqualFold(columns[i].Name, name) {
+			return &columns[i]
+		}
+	}
+	return nil
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildSelect renders the page's SELECT: req's filter ANDed with "sort key
+// after the cursor", ordered by the sort key. One row more than the limit is
+// read to tell whether another page follows.
+func (p *keysetPage) buildSelect(req selectRequest) (string, []interface{}, error) {
+	table, err := qualifiedTable(req.DBName, req.Table)
+	if err != nil {
+		return "", nil, err
+	}
+	var conditions []string
+	var args []interface{}
+	if req.Where != nil {
+		where, whereArgs, err := req.Where.build()
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, "("+where+")")
+		args = append(args, whereArgs...)
+	}
+	if p.after != nil {
+		// (a > ?) OR (a = ? AND b > ?) OR ..., with < for descending keys.
+		var alternatives []string
+		for i, term := range p.order {
+			var parts []string
+			for j := 0; j <= i; j++ {
+				col, err := quoteIdent(p.order[j].Column)
+				if err != nil {
+					return "", nil, err
+				}
+				op := "="
+				if j == i {
+					op = ">"
+					if term.Desc {
+						op = "<"
+					}
+				}
+				parts = append(parts, col+" "+op+" ?")
+				args = append(args, string(p.after[j]))
+			}
+			alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+		}
+		conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	from := "FROM " + table
+	if len(conditions) > 0 {
+		from += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	projected := req
+	if len(req.Columns) > 0 {
+		projected.Columns = append(append([]string{}, req.Columns...), p.extra...)
+	}
+	cols, err := projected.projection()
+	if err != nil {
+		return "", nil, err
+	}
+	order, err := orderClause(p.order)
+	if err != nil {
+		return "", nil, err
+	}
+	limit, err := limitClause(req.Limit+1, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	return "SELECT " + cols + " " + from + order + limit, args, nil
+}
+
+// keyText renders a scanned sort key value in the text form MySQL compares
+// it with.
+func keyText(v interface{}) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return append([]byte{}, v...)
+	case int64:
+		return strconv.AppendInt(nil, v, 10)
+	case uint64:
+		return strconv.AppendUint(nil, v, 10)
+	case float64:
+		return strconv.AppendFloat(nil, v, 'g', -1, 64)
+	case float32:
+		return strconv.AppendFloat(nil, float64(v), 'g', -1, 32)
+	case time.Time:
+		return []byte(v.Format(mysqlDateTime))
+	}
+	return []byte(fmt.Sprint(v))
+}
+
+// scan reads up to limit rows of the page like scanResult and returns the
+// cursor of the next page, or "" if this is the last one.
+func (p *keysetPage) scan(rows *sql.Rows, limit int) ([]columnInfo, []map[string]interface{}, string, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("Failed to get columns: %v", err)
+	}
+	columns := resultColumns(types)
+	keyIndex := make([]int, len(p.order))
+	for i, term := range p.order {
+		keyIndex[i] = -1
+		for j, col := range columns {
+			if strings.EqualFold(col.Name, term.Column) {
+				keyIndex[i] = j
+				break
+			}
+		}
+		if keyIndex[i] < 0 {
+			return nil, nil, "", fmt.Errorf("sort column %q missing from result", term.Column)
+		}
+	}
+
+	results := []map[string]interface{}{}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	var last [][]byte
+	more := false
+	for rows.Next() {
+		if len(results) == limit {
+			more = true
+			break
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, nil, "", fmt.Errorf("Failed to scan row: %v", err)
+		}
+		row := decodeRow(columns, values)
+		for _, name := range p.extra {
+			for key := range row {
+				if strings.EqualFold(key, name) {
+					delete(row, key)
+				}
+			}
+		}
+		results = append(results, row)
+		last = make([][]byte, len(keyIndex))
+		for i, j := range keyIndex {
+			last[i] = keyText(values[j])
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, "", fmt.Errorf("Error during rows iteration: %v", err)
+	}
+
+	if len(p.extra) > 0 {
+		visible := columns[:0:0]
+		for _, col := range columns {
+			if !containsFold(p.extra, col.Name) {
+				visible = append(visible, col)
+			}
+		}
+		columns = visible
+	}
+	if !more {
+		return columns, results, "", nil
+	}
+	next, err := p.cursor(last)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return columns, results, next, nil
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// timeoutHeader lets a client choose its own deadline, e.g. "5s", "90" (in
+// seconds) or "max". The timeout query parameter does the same.
+const timeoutHeader = "X-Request-Timeout"
+
+// requestTimeout is the deadline of a request that does not ask for one,
+// maxRequestTimeout the longest a client may ask for. They are read from
+// REQUEST_TIMEOUT (default 30s) and REQUEST_TIMEOUT_MAX (default 10m).
+var (
+	requestTimeout    = envDuration("REQUEST_TIMEOUT", 30*time.Second)
+	maxRequestTimeout = envDuration("REQUEST_TIMEOUT_MAX", 10*time.Minute)
+)
+
+// longRunningPaths get maxRequestTimeout unless the client asks for less.
+var longRunningPaths = map[string]bool{
+	"/export":      true,
+	"/import":      true,
+	"/bulk-insert": true,
+	"/migrate":     true,
+	"/rollback":    true,
+}
+
+// errRequestKilled is the cancellation cause of a request killed through
+// /running-queries.
+var errRequestKilled = errors.New("request killed by an admin")
+
+// queryTagPrefix marks the statements of this process in the MySQL process
+// list. Every request gets its own tag, prepended to its SQL as a comment.
+var (
+	queryTagPrefix = "dbq:" + randomHex(4) + "-"
+	querySeq       atomic.Uint64
+)
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type queryTagKey struct{}
+
+// tagQuery prefixes query with the tag of the request in ctx, if any, so the
+// statement can be found and killed while it runs.
+func tagQuery(ctx context.Context, query string) string {
+	if tag, ok := ctx.Value(queryTagKey{}).(string); ok {
+		return "/* " + tag + " */ " + query
+	}
+	return query
+}
+
+// writeTagSuffix marks the statements of a request that must not be killed
+// with it; see detachWrite.
+const writeTagSuffix = "-w"
+
+// detachWrite returns the context a write statement runs under. Once a write
+// has been sent, MySQL may commit it whatever happens to the request, and a
+// committed write has to be replicated. So the statement ignores the
+// request's cancellation and deadline, and killTagged leaves it alone; the
+// handler then replicates as if the client were still there.
+func detachWrite(ctx context.Context) context.Context {
+	ctx = context.WithoutCancel(ctx)
+	if tag, ok := ctx.Value(queryTagKey{}).(string); ok {
+		ctx = context.WithValue(ctx, queryTagKey{}, tag+writeTagSuffix)
+	}
+	return ctx
+}
+
+// activeRequest is a request this node is serving.
+type activeRequest struct {
+	requestID string
+	method    string
+	path      string
+	cancel    context.CancelCauseFunc
+}
+
+var activeRequests = struct {
+	sync.Mutex
+	byTag map[string]*activeRequest
+}{byTag: map[string]*activeRequest{}}
+
+// parseTimeout reads the deadline a client asked for; zero means none.
+func parseTimeout(r *http.Request) (time.Duration, error) {
+	raw := r.URL.Query().Get("timeout")
+	if raw == "" {
+		raw = r.Header.Get(timeoutHeader)
+	}
+	switch {
+	case raw == "":
+		return 0, nil
+	case raw == "max":
+		return maxRequestTimeout, nil
+	}
+	if secs, err := strconv.ParseUint(raw, 10, 32); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second, nil
+	}
+	if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, errors.New("invalid timeout " + strconv.Quote(raw))
+}
+
+type requestTimeoutKey struct{}
+
+// requestTimeoutFrom returns the deadline the request in ctx was given, or
+// zero if it has none.
+func requestTimeoutFrom(ctx context.Context) time.Duration {
+	timeout, _ := ctx.Value(requestTimeoutKey{}).(time.Duration)
+	return timeout
+}
+
+// withDeadline gives every request a deadline and a query tag. When the
+// deadline passes, the client disconnects or an admin kills the request, its
+// context is cancelled and the MySQL statements still running for it are
+// killed. Replication calls are exempt from both the deadline and the
+// disconnect: the master already committed the write, so a replica finishes
+// it even after the master stops waiting. Only an admin can kill them.
+func withDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout, err := parseTimeout(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/replicate/"):
+			timeout = 0
+		case timeout == 0 && longRunningPaths[r.URL.Path]:
+			timeout = maxRequestTimeout
+		case timeout == 0:
+			timeout = requestTimeout
+		case timeout > maxRequestTimeout:
+			timeout = maxRequestTimeout
+		}
+
+		base := r.Context()
+		if strings.HasPrefix(r.URL.Path, "/replicate/") {
+			base = context.WithoutCancel(base)
+		}
+		ctx, cancel := context.WithCancelCause(base)
+		defer cancel(nil)
+		if timeout > 0 {
+			var cancelTimeout context.CancelFunc
+			ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+			defer cancelTimeout()
+		}
+		tag := queryTagPrefix + strconv.FormatUint(querySeq.Add(1), 10)
+		ctx = context.WithValue(ctx, queryTagKey{}, tag)
+		ctx = context.WithValue(ctx, requestTimeoutKey{}, timeout)
+
+		activeRequests.Lock()
+		activeRequests.byTag[tag] = &activeRequest{
+			requestID: requestIDFrom(ctx),
+			method:    r.Method,
+			path:      r.URL.Path,
+			cancel:    cancel,
+		}
+		activeRequests.Unlock()
+		defer func() {
+			activeRequests.Lock()
+			delete(activeRequests.byTag, tag)
+			activeRequests.Unlock()
+		}()
+
+		// Cancelling the context only drops the connection on our side;
+		// MySQL keeps running the statement until it is killed.
+		stop := context.AfterFunc(ctx, func() {
+			loggerFrom(ctx).Warn("Request cancelled", "cause", context.Cause(ctx).Error())
+			killTagged(ctx, tag)
+		})
+		defer stop()
+
+		next.ServeHTTP(&deadlineWriter{ResponseWriter: w, ctx: ctx}, r.WithContext(ctx))
+	})
+}
+
+// deadlineWriter reports handler failures caused by the deadline as 504.
+type deadlineWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+}
+
+func (d *deadlineWriter) WriteHeader(code int) {
+	if code == http.StatusInternalServerError && errors.Is(d.ctx.Err(), context.DeadlineExceeded) {
+		code = http.StatusGatewayTimeout
+	}
+	d.ResponseWriter.WriteHeader(code)
+}
+
+func (d *deadlineWriter) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
+
+// runningQuery is a statement of this node in the MySQL process list.
+type runningQuery struct {
+	ID        uint64 `json:"id"`
+	RequestID string `json:"requestId,omitempty"`
+	Method    string `json:"method,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Seconds   int64  `json:"seconds"`
+	State     string `json:"state"`
+	SQL       string `json:"sql"`
+}
+
+// listRunningQueries returns the statements of this node that MySQL is
+// executing, except the one reading the list. Statements whose tag starts
+// with prefix are returned.
+func listRunningQueries(ctx context.Context, prefix string) ([]runningQuery, error) {
+	rows, err := db.QueryContext(ctx, "SELECT ID, TIME, COALESCE(STATE, ''), INFO FROM information_schema.PROCESSLIST "+
+		"WHERE INFO LIKE ? AND ID <> CONNECTION_ID() ORDER BY TIME DESC", "/* "+prefix+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activeRequests.Lock()
+	defer activeRequests.Unlock()
+	queries := []runningQuery{}
+	for rows.Next() {
+		var q runningQuery
+		if err := rows.Scan(&q.ID, &q.Seconds, &q.State, &q.SQL); err != nil {
+			return nil, err
+		}
+		tag, statement, _ := strings.Cut(strings.TrimPrefix(q.SQL, "/* "), " */ ")
+		q.SQL = statement
+		if req := activeRequests.byTag[strings.TrimSuffix(tag, writeTagSuffix)]; req != nil {
+			q.RequestID, q.Method, q.Path = req.requestID, req.method, req.path
+		}
+		queries = append(queries, q)
+	}
+	return queries, rows.Err()
+}
+
+// killQuery stops the statement running on MySQL connection id. The
+// connection itself stays open.
+func killQuery(ctx context.Context, id uint64) error {
+	_, err := db.ExecContext(ctx, "KILL QUERY "+strconv.FormatUint(id, 10))
+	return err
+}
+
+// killTagged kills the statements still running for the request with tag,
+// except the writes it detached.
+func killTagged(ctx context.Context, tag string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	queries, err := listRunningQueries(ctx, tag+" */")
+	if err != nil {
+		loggerFrom(ctx).Error("Failed to list running queries", "error", err)
+		return
+	}
+	for _, q := range queries {
+		if err := killQuery(ctx, q.ID); err != nil {
+			loggerFrom(ctx).Error("Failed to kill query", "id", q.ID, "error", err)
+		}
+	}
+}
+
+// manageRunningQueries lists the statements this node is executing on GET.
+// DELETE kills one statement (?id=, a MySQL connection ID from the list) or
+// cancels every request with a request ID (?requestId=). Both need the admin
+// token.
+func manageRunningQueries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	queries, err := listRunningQueries(r.Context(), queryTagPrefix)
+	if err != nil {
+		http.Error(w, "Failed to list running queries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"queries": queries})
+		return
+	}
+
+	if requestID := r.URL.Query().Get("requestId"); requestID != "" {
+		cancelled := 0
+		activeRequests.Lock()
+		for _, req := range activeRequests.byTag {
+			if req.requestID == requestID && req.requestID != requestIDFrom(r.Context()) {
+				req.cancel(errRequestKilled)
+				cancelled++
+			}
+		}
+		activeRequests.Unlock()
+		if cancelled == 0 {
+			http.Error(w, "No running request with this ID", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Request cancelled", "cancelled": cancelled})
+		return
+	}
+
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id or requestId parameter is required", http.StatusBadRequest)
+		return
+	}
+	// Only statements of this node may be killed, not arbitrary sessions.
+	found := false
+	for _, q := range queries {
+		found = found || q.ID == id
+	}
+	if !found {
+		http.Error(w, "No running query with this ID", http.StatusNotFound)
+		return
+	}
+	if err := killQuery(r.Context(), id); err != nil {
+		http.Error(w, "Failed to kill query: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Query killed"})
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// errTableNotFound is returned by describeTable for a missing table.
+var errTableNotFound = errors.New("Table not found")
+
+// systemSchemas are MySQL's own databases and the cluster metadata database,
+// hidden from /databases.
+const systemSchemas = "'information_schema', 'mysql', 'performance_schema', 'sys', '" + clusterSchema + "'"
+
+// tableSummary is one entry of /tables. RowEstimate comes from
+// information_schema and may lag behind the real row count.
+type tableSummary struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	RowEstimate *int64 `json:"rowEstimate"`
+}
+
+// schemaColumn describes one column of a table.
+type schemaColumn struct {
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Nullable bool    `json:"nullable"`
+	Default  *string `json:"default"`
+	Key      string  `json:"key,omitempty"`
+	Extra    string  `json:"extra,omitempty"`
+}
+
+// schemaIndex describes one index; Columns are in index order. Functional
+// index parts have no column and are listed as "(expression)".
+type schemaIndex struct {
+	Name    string   `json:"name"`
+	Unique  bool     `json:"unique"`
+	Type    string   `json:"type"`
+	Columns []string `json:"columns"`
+}
+
+// tableDescription is the response of /describe.
+type tableDescription struct {
+	Database    string         `json:"dbname"`
+	Table       string         `json:"table"`
+	Type        string         `json:"type"`
+	Engine      string         `json:"engine,omitempty"`
+	RowEstimate *int64         `json:"rowEstimate"`
+	PrimaryKey  []string       `json:"primaryKey"`
+	Columns     []schemaColumn `json:"columns"`
+	Indexes     []schemaIndex  `json:"indexes"`
+}
+
+func nullInt64(n sql.NullInt64) *int64 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Int64
+}
+
+func databaseExists(ctx context.Context, dbname string) (bool, error) {
+	var n int
+	err := dbQueryRow(ctx, "SELECT COUNT(*) FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?", dbname).Scan(&n)
+	return n > 0, err
+}
+
+// describeTable reads the structure of dbname.table from information_schema.
+func describeTable(ctx context.Context, dbname, table string) (*tableDescription, error) {
+	desc := &tableDescription{Database: dbname, Table: table, PrimaryKey: []string{}}
+
+	var engine sql.NullString
+	var rowsEstimate sql.NullInt64
+	err := dbQueryRow(ctx, `SELECT TABLE_TYPE, ENGINE, TABLE_ROWS FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?`, dbname, table).Scan(&desc.Type, &engine, &rowsEstimate)
+	if err == sql.ErrNoRows {
+		return nil, errTableNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	desc.Engine = engine.String
+	desc.RowEstimate = nullInt64(rowsEstimate)
+
+	rows, err := dbQuery(ctx, `SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLUMN_DEFAULT, COLUMN_KEY, EXTRA
+		FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION`, dbname, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var col schemaColumn
+		var nullable string
+		var def sql.NullString
+		if err := rows.Scan(&col.Name, &col.Type, &nullable, &def, &col.Key, &col.Extra); err != nil {
+			return nil, err
+		}
+		col.Nullable = nullable == "YES"
+		if def.Valid {
+			col.Default = &def.String
+		}
+		desc.Columns = append(desc.Columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = dbQuery(ctx, `SELECT INDEX_NAME, NON_UNIQUE, INDEX_TYPE, COLUMN_NAME
+		FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+		ORDER BY INDEX_NAME = 'PRIMARY' DESC, INDEX_NAME, SEQ_IN_INDEX`, dbname, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	desc.Indexes = []schemaIndex{}
+	for rows.Next() {
+		var name, indexType string
+		var nonUnique int
+		var column sql.NullString
+		if err := rows.Scan(&name, &nonUnique, &indexType, &column); err != nil {
+			return nil, err
+		}
+		if !column.Valid {
+			column.String = "(expression)"
+		}
+		if n := len(desc.Indexes); n == 0 || desc.Indexes[n-1].Name != name {
+			desc.Indexes = append(desc.Indexes, schemaIndex{Name: name, Unique: nonUnique == 0, Type: indexType})
+		}
+		last := &desc.Indexes[len(desc.Indexes)-1]
+		last.Columns = append(last.Columns, column.String)
+		if name == "PRIMARY" {
+			desc.PrimaryKey = append(desc.PrimaryKey, column.String)
+		}
+	}
+	return desc, rows.Err()
+}
+
+func listDatabases(w http.ResponseWriter, r *http.Request) {
+	rows, err := dbQuery(r.Context(), "SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME NOT IN ("+systemSchemas+") ORDER BY SCHEMA_NAME")
+	if err != nil {
+		http.Error(w, "Failed to list databases: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	databases := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			http.Error(w, "Failed to scan row: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		databases = append(databases, name)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during rows iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"databases": databases})
+}
+
+func listTables(w http.ResponseWriter, r *http.Request) {
+	dbname := r.URL.Query().Get("dbname")
+	if dbname == "" {
+		http.Error(w, "dbname parameter is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := quoteIdent(dbname); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	exists, err := databaseExists(r.Context(), dbname)
+	if err != nil {
+		http.Error(w, "Failed to list tables: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Database not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := dbQuery(r.Context(), `SELECT TABLE_NAME, TABLE_TYPE, TABLE_ROWS FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME`, dbname)
+	if err != nil {
+		http.Error(w, "Failed to list tables: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tables := []tableSummary{}
+	for rows.Next() {
+		var t tableSummary
+		var rowsEstimate sql.NullInt64
+		if err := rows.Scan(&t.Name, &t.Type, &rowsEstimate); err != nil {
+			http.Error(w, "Failed to scan row: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		t.RowEstimate = nullInt64(rowsEstimate)
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during rows iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"dbname": dbname, "tables": tables})
+}
+
+func describe(w http.ResponseWriter, r *http.Request) {
+	dbname := r.URL.Query().Get("dbname")
+	table := r.URL.Query().Get("table")
+	if dbname == "" || table == "" {
+		http.Error(w, "Both dbname and table parameters are required", http.StatusBadRequest)
+		return
+	}
+	if _, err := qualifiedTable(dbname, table); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	desc, err := describeTable(r.Context(), dbname, table)
+	if err == errTableNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to describe table: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(desc)
+}
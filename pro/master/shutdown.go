@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// shuttingDown is set once a shutdown signal arrives so that readiness checks
+// start failing before the listener closes.
+var shuttingDown atomic.Bool
+
+// shutdownTimeout bounds each shutdown phase (in-flight requests, replication
+// drain). It is read from SHUTDOWN_TIMEOUT and defaults to 15s.
+func shutdownTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 15 * time.Second
+}
+
+// serve runs the HTTP server on addr until SIGINT or SIGTERM, then shuts the
+// node down in order: stop accepting requests and let in-flight handlers
+// finish, drain replication, hand leadership and the replication that could
+// not be delivered in time to a slave if this node is the master, persist
+// that replication otherwise, and close db.
+func serve(addr string, handler http.Handler) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: addr, Handler: handler}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+	shuttingDown.Store(true)
+
+	timeout := shutdownTimeout()
+	slog.Info("Shutting down", "timeout", timeout.String())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("HTTP server did not shut down cleanly", "error", err)
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("HTTP server stopped", "error", err)
+	}
+
+	slog.Info("Draining replication", "pending", pendingReplicationCount())
+	pending := drainReplication(timeout)
+	if nodeIsMaster() && handOffLeadership(pending) {
+		pending = nil
+	}
+	if err := persistReplication(pending); err != nil {
+		slog.Error("Failed to persist pending replication", "tasks", len(pending), "error", err)
+	} else if len(pending) > 0 {
+		slog.Info("Pending replication persisted", "tasks", len(pending), "file", pendingReplicationFile())
+	}
+
+	if err := db.Close(); err != nil {
+		slog.Error("Failed to close database", "error", err)
+	}
+	slog.Info("Shutdown complete")
+	return nil
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Statement classes reported by classifySQL.
+const (
+	statementRead = "read"
+	statementDML  = "dml"
+	statementDDL  = "ddl"
+)
+
+// forwardedHeader marks a write that a replica has already forwarded to the
+// master, so a node that is not the master never forwards it again.
+const forwardedHeader = "X-Forwarded-Write"
+
+// sqlToken is a lexical token of a statement. Words are upper-cased in text;
+// quoted strings and identifiers have no text, so they never match a
+// keyword. name holds a word or quoted identifier as written, unquoted.
+type sqlToken struct {
+	kind  byte // 'w' word, 's' string, 'i' quoted identifier, '?' parameter, 'p' punctuation
+	text  string
+	name  string
+	depth int // parenthesis nesting level
+	pos   int // byte offset in the statement
+}
+
+// tokenizeSQL splits query into tokens, skipping whitespace and comments.
+// MySQL executable comments (/*! ... */) are rejected because their content
+// runs as SQL.
+func tokenizeSQL(query string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	depth := 0
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case c == '#' || (strings.HasPrefix(query[i:], "--") && (i+2 == len(query) || strings.ContainsRune(" \t\n\r", rune(query[i+2])))):
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			if strings.HasPrefix(query[i:], "/*!") || strings.HasPrefix(query[i:], "/*+") {
+				return nil, errors.New("executable comments and optimizer hints are not allowed")
+			}
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.New("unterminated comment")
+			}
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(query); j++ {
+				if query[j] == '\\' && c != '`' {
+					j++
+					continue
+				}
+				if query[j] == c {
+					if j+1 < len(query) && query[j+1] == c {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(query) {
+				return nil, errors.New("unterminated quoted string or identifier")
+			}
+			token := sqlToken{kind: 's', depth: depth, pos: i}
+			if c == '`' {
+				token.kind = 'i'
+				token.name = strings.ReplaceAll(query[i+1:j], "``", "`")
+			}
+			tokens = append(tokens, token)
+			i = j + 1
+		case isWordByte(c):
+			j := i
+			for j < len(query) && isWordByte(query[j]) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: 'w', text: strings.ToUpper(query[i:j]), name: query[i:j], depth: depth, pos: i})
+			i = j
+		case c == '?':
+			tokens = append(tokens, sqlToken{kind: '?', text: "?", depth: depth, pos: i})
+			i++
+		default:
+			if c == ')' {
+				depth--
+			}
+			tokens = append(tokens, sqlToken{kind: 'p', text: string(c), depth: depth, pos: i})
+			if c == '(' {
+				depth++
+			}
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// splitStatements splits a script into its ;-separated statements, ignoring
+// semicolons inside strings, identifiers and comments, and dropping
+// statements that are empty or only comments.
+func splitStatements(script string) ([]string, error) {
+	tokens, err := tokenizeSQL(script)
+	if err != nil {
+		return nil, err
+	}
+	var statements []string
+	start, empty := 0, true
+	for _, t := range tokens {
+		if t.text != ";" {
+			empty = false
+			continue
+		}
+		if !empty {
+			statements = append(statements, strings.TrimSpace(script[start:t.pos]))
+		}
+		start, empty = t.pos+1, true
+	}
+	if !empty {
+		statements = append(statements, strings.TrimSpace(script[start:]))
+	}
+	return statements, nil
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// ddlObjects are the object types that /query may create, alter or drop.
+// Users, roles, stored programs, temporary tables and the like are
+// rejected: they are either security-sensitive or do not replicate cleanly.
+var ddlObjects = map[string][]string{
+	"CREATE": {"DATABASE", "SCHEMA", "TABLE", "INDEX", "VIEW"},
+	"ALTER":  {"DATABASE", "SCHEMA", "TABLE", "VIEW"},
+	"DROP":   {"DATABASE", "SCHEMA", "TABLE", "INDEX", "VIEW"},
+	"RENAME": {"TABLE"},
+}
+
+// ddlObjectKeywords are the words that name the object type of a CREATE,
+// ALTER, DROP or RENAME statement.
+var ddlObjectKeywords = map[string]bool{
+	"DATABASE": true, "SCHEMA": true, "TABLE": true, "INDEX": true, "VIEW": true,
+	"TEMPORARY": true, "USER": true, "ROLE": true, "PROCEDURE": true, "FUNCTION": true,
+	"TRIGGER": true, "EVENT": true, "TABLESPACE": true, "SERVER": true, "LOGFILE": true,
+	"INSTANCE": true, "RESOURCE": true, "UNDO": true,
+}
+
+// nondeterministicFuncs return a different value on every node, so a write
+// using them would leave the replicas out of sync with the master.
+var nondeterministicFuncs = map[string]bool{
+	"RAND": true, "UUID": true, "UUID_SHORT": true, "SYSDATE": true, "NOW": true,
+	"CURDATE": true, "CURTIME": true, "CURRENT_DATE": true, "CURRENT_TIME": true,
+	"CURRENT_TIMESTAMP": true, "LOCALTIME": true, "LOCALTIMESTAMP": true,
+	"UTC_DATE": true, "UTC_TIME": true, "UTC_TIMESTAMP": true, "UNIX_TIMESTAMP": true,
+	"CONNECTION_ID": true, "CURRENT_USER": true, "USER": true, "SESSION_USER": true,
+	"SYSTEM_USER": true, "LAST_INSERT_ID": true, "FOUND_ROWS": true, "ROW_COUNT": true,
+}
+
+// nondeterministicKeywords may be used without parentheses.
+var nondeterministicKeywords = map[string]bool{
+	"CURRENT_DATE": true, "CURRENT_TIME": true, "CURRENT_TIMESTAMP": true,
+	"LOCALTIME": true, "LOCALTIMESTAMP": true, "CURRENT_USER": true,
+}
+
+// classifySQL checks that query is a single allowed statement and reports
+// whether it is a read, DML or DDL statement, along with the number of ?
+// placeholders it contains. Writes may not mention the cluster schema.
+func classifySQL(query string) (string, int, error) {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return "", 0, err
+	}
+	if n := len(tokens); n > 0 && tokens[n-1].text == ";" {
+		tokens = tokens[:n-1]
+	}
+	if len(tokens) == 0 {
+		return "", 0, errors.New("Empty statement")
+	}
+	params := 0
+	for i, t := range tokens {
+		switch {
+		case t.text == ";":
+			return "", 0, errors.New("Multiple statements are not allowed")
+		case t.kind == '?':
+			params++
+		case t.text == "LOAD_FILE" && i+1 < len(tokens) && tokens[i+1].text == "(":
+			return "", 0, errors.New("LOAD_FILE is not allowed")
+		case t.text == "INTO" && i+1 < len(tokens) && (tokens[i+1].text == "OUTFILE" || tokens[i+1].text == "DUMPFILE"):
+			return "", 0, errors.New("SELECT ... INTO " + tokens[i+1].text + " is not allowed")
+		}
+	}
+	if tokens[0].kind != 'w' {
+		return "", 0, errors.New("Statement must start with a keyword")
+	}
+
+	kind, err := statementClass(tokens)
+	if err != nil {
+		return "", 0, err
+	}
+	if kind != statementRead {
+		// The cluster keeps its migration history and named queries there;
+		// only the endpoints that manage them may change it.
+		for _, t := range tokens {
+			if (t.kind == 'w' || t.kind == 'i') && strings.EqualFold(t.name, clusterSchema) {
+				return "", 0, errClusterSchema
+			}
+		}
+	}
+
+	switch kind {
+	case statementRead:
+		for _, t := range tokens {
+			if t.text == "INTO" {
+				return "", 0, errors.New("SELECT ... INTO is not allowed")
+			}
+		}
+	case statementDML:
+		for i, t := range tokens {
+			call := i+1 < len(tokens) && tokens[i+1].text == "("
+			if t.kind == 'w' && ((nondeterministicFuncs[t.text] && call) || nondeterministicKeywords[t.text]) {
+				return "", 0, fmt.Errorf("%s is not deterministic and would differ on the replicas; pass the value as a parameter", t.text)
+			}
+		}
+	case statementDDL:
+		if params > 0 {
+			return "", 0, errors.New("DDL statements do not take parameters")
+		}
+	}
+	return kind, params, nil
+}
+
+// statementClass classifies a tokenized statement by its leading keywords.
+func statementClass(tokens []sqlToken) (string, error) {
+	first := tokens[0].text
+	next := ""
+	if len(tokens) > 1 {
+		next = tokens[1].text
+	}
+
+	switch first {
+	case "SELECT", "SHOW", "TABLE", "VALUES":
+		return statementRead, nil
+	case "EXPLAIN", "DESCRIBE", "DESC":
+		if next == "ANALYZE" {
+			// EXPLAIN ANALYZE executes the statement it explains.
+			if len(tokens) < 3 || tokens[2].text != "SELECT" {
+				return "", errors.New("EXPLAIN ANALYZE is only allowed for SELECT")
+			}
+		}
+		return statementRead, nil
+	case "WITH":
+		// The statement kind follows the common table expressions.
+		for _, t := range tokens[1:] {
+			if t.depth != 0 || t.kind != 'w' {
+				continue
+			}
+			switch t.text {
+			case "SELECT", "TABLE", "VALUES":
+				return statementRead, nil
+			case "UPDATE", "DELETE":
+				return statementDML, nil
+			}
+		}
+		return "", errors.New("WITH must be followed by SELECT, UPDATE or DELETE")
+	case "INSERT", "REPLACE", "UPDATE", "DELETE":
+		return statementDML, nil
+	case "TRUNCATE":
+		return statementDDL, nil
+	case "CREATE", "ALTER", "DROP", "RENAME":
+		for _, t := range tokens[1:] {
+			if t.kind != 'w' || !ddlObjectKeywords[t.text] {
+				continue
+			}
+			for _, allowed := range ddlObjects[first] {
+				if t.text == allowed {
+					return statementDDL, nil
+				}
+			}
+			return "", fmt.Errorf("%s %s statements are not allowed", first, t.text)
+		}
+		return "", fmt.Errorf("Unsupported %s statement", first)
+	}
+	return "", fmt.Errorf("%s statements are not allowed", first)
+}
+
+// sqlRequest is the body of /query and /replicate/query.
+type sqlRequest struct {
+	SQL    string        `json:"sql"`
+	Params []interface{} `json:"params,omitempty"`
+}
+
+// prepare validates req and returns its class and statement arguments.
+func (req sqlRequest) prepare() (string, []interface{}, error) {
+	kind, placeholders, err := classifySQL(req.SQL)
+	if err != nil {
+		return "", nil, err
+	}
+	if placeholders != len(req.Params) {
+		return "", nil, fmt.Errorf("statement has %d placeholders but %d params were given", placeholders, len(req.Params))
+	}
+	args := make([]interface{}, len(req.Params))
+	for i, p := range req.Params {
+		if args[i], err = sqlValue(p); err != nil {
+			return "", nil, err
+		}
+	}
+	return kind, args, nil
+}
+
+// runQuery executes an arbitrary SQL statement. Reads run on this node;
+// writes run on the master, which replicates them. A replica forwards writes
+// to the master it currently follows. When ADMIN_TOKEN is set, only admins
+// may run ad hoc SQL; other clients are limited to named queries (/call).
+func runQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var req sqlRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	runStatement(w, r, req, body)
+}
+
+// runStatement validates and executes req for /query and /call. body is the
+// raw request, replayed on the master when a replica receives a write.
+func runStatement(w http.ResponseWriter, r *http.Request, req sqlRequest, body []byte) {
+	kind, args, err := req.prepare()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if kind == statementRead {
+		rows, err := dbQuery(r.Context(), req.SQL, args...)
+		if err != nil {
+			http.Error(w, "Failed to run query: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		columns, results, err := scanResult(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"type":    kind,
+			"columns": columns,
+			"rows":    results,
+		})
+		return
+	}
+
+	if !nodeIsMaster() {
+		if r.Header.Get(forwardedHeader) != "" {
+			http.Error(w, "This node is not the master", http.StatusServiceUnavailable)
+			return
+		}
+		forwardToMaster(w, r, body)
+		return
+	}
+
+	if !executeWrite(w, r, kind, req.SQL, args) {
+		return
+	}
+	replicateToSlavesJSON(r.Context(), "/replicate/query", req)
+}
+
+// executeWrite runs a DML or DDL statement and writes the response. It
+// reports whether the statement succeeded.
+func executeWrite(w http.ResponseWriter, r *http.Request, kind, query string, args []interface{}) bool {
+	result, err := dbExec(detachWrite(r.Context()), query, args...)
+	if err != nil {
+		http.Error(w, "Failed to run statement: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	// Any table may have changed.
+	resultCache.purge()
+	rowsAffected, _ := result.RowsAffected()
+	lastInsertID, _ := result.LastInsertId()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Statement executed successfully",
+		"type":         kind,
+		"rowsAffected": rowsAffected,
+		"lastInsertId": lastInsertID,
+	})
+	return true
+}
+
+// forwardToMaster replays a write request on the master and relays its
+// response to the client.
+func forwardToMaster(w http.ResponseWriter, r *http.Request, body []byte) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, currentMaster()+r.URL.Path, bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, "Failed to forward to master: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(forwardedHeader, "1")
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	if id := requestIDFrom(r.Context()); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+
+	resp, err := replicationClient.Do(req)
+	if err != nil {
+		http.Error(w, "Failed to reach master: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// replicateQuery applies a write statement that the master executed through
+// /query.
+func replicateQuery(w http.ResponseWriter, r *http.Request) {
+	var req sqlRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	kind, args, err := req.prepare()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if kind == statementRead {
+		http.Error(w, "Only write statements are replicated", http.StatusBadRequest)
+		return
+	}
+	executeWrite(w, r, kind, req.SQL, args)
+}
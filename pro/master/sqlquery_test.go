@@ -0,0 +1,154 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenizeSQL(t *testing.T) {
+	tokens, err := tokenizeSQL("select `a``b`, 'x;' /* c */ FROM t -- d\nWHERE (id = ?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []sqlToken{
+		{kind: 'w', text: "SELECT", name: "select"},
+		{kind: 'i', name: "a`b"},
+		{kind: 'p', text: ","},
+		{kind: 's'},
+		{kind: 'w', text: "FROM", name: "FROM"},
+		{kind: 'w', text: "T", name: "t"},
+		{kind: 'w', text: "WHERE", name: "WHERE"},
+		{kind: 'p', text: "("},
+		{kind: 'w', text: "ID", name: "id", depth: 1},
+		{kind: 'p', text: "=", depth: 1},
+		{kind: '?', text: "?", depth: 1},
+		{kind: 'p', text: ")"},
+	}
+	for i := range tokens {
+		tokens[i].pos = 0
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("tokenizeSQL = %+v\nwant %+v", tokens, want)
+	}
+
+	for _, query := range []string{
+		"SELECT 'open",
+		"SELECT `open",
+		"SELECT 1 /* open",
+		"SELECT /*! 1 */",
+		"SELECT /*+ NO_INDEX(t) */ * FROM t",
+	} {
+		if _, err := tokenizeSQL(query); err == nil {
+			t.Errorf("tokenizeSQL(%q) succeeded, want an error", query)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		script string
+		want   []string
+	}{
+		{"SELECT 1", []string{"SELECT 1"}},
+		{"CREATE TABLE d.a (x INT);\nINSERT INTO d.a VALUES (';');", []string{"CREATE TABLE d.a (x INT)", "INSERT INTO d.a VALUES (';')"}},
+		{"SELECT 1 /* ; */; SELECT `a;b` FROM t", []string{"SELECT 1 /* ; */", "SELECT `a;b` FROM t"}},
+		{"  ; -- only a comment\n ; SELECT 'it''s';", []string{"SELECT 'it''s'"}},
+		{"SELECT 'a\\';'; SELECT 2", []string{"SELECT 'a\\';'", "SELECT 2"}},
+		{"-- nothing\n", nil},
+	}
+	for _, tt := range tests {
+		got, err := splitStatements(tt.script)
+		if err != nil {
+			t.Errorf("splitStatements(%q): %v", tt.script, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitStatements(%q) = %q, want %q", tt.script, got, tt.want)
+		}
+	}
+
+	if _, err := splitStatements("SELECT 1; SELECT 'open"); err == nil {
+		t.Error("splitStatements accepted an unterminated string")
+	}
+}
+
+func TestClassifySQL(t *testing.T) {
+	tests := []struct {
+		query  string
+		kind   string
+		params int
+		err    string
+	}{
+		// Reads.
+		{query: "SELECT 1", kind: statementRead},
+		{query: "select * from d.t where id = ? and name = ?", kind: statementRead, params: 2},
+		{query: "SELECT 1;", kind: statementRead},
+		{query: "SELECT ';' FROM d.t", kind: statementRead},
+		{query: "SELECT 'a\\';' FROM d.t", kind: statementRead},
+		{query: "SELECT 1 -- ; DROP TABLE d.t", kind: statementRead},
+		{query: "SELECT 1 # ; DROP TABLE d.t", kind: statementRead},
+		{query: "SELECT /* ; DROP TABLE d.t */ 1", kind: statementRead},
+		{query: "SELECT NOW(), RAND()", kind: statementRead},
+		{query: "WITH c AS (SELECT 1) SELECT * FROM c", kind: statementRead},
+		{query: "SHOW TABLES FROM d", kind: statementRead},
+		{query: "EXPLAIN ANALYZE SELECT * FROM d.t", kind: statementRead},
+		{query: "SELECT * FROM _cluster.named_queries", kind: statementRead},
+
+		// Writes.
+		{query: "INSERT INTO d.t (a, b) VALUES (?, ?)", kind: statementDML, params: 2},
+		{query: "UPDATE d.t SET a = 'NOW()' WHERE id = ?", kind: statementDML, params: 1},
+		{query: "UPDATE d.t SET `now` = 1", kind: statementDML},
+		{query: "WITH c AS (SELECT 1) DELETE FROM d.t", kind: statementDML},
+		{query: "CREATE TABLE d.t (id INT PRIMARY KEY)", kind: statementDDL},
+		{query: "ALTER TABLE d.t ADD COLUMN c INT", kind: statementDDL},
+		{query: "DROP VIEW d.v", kind: statementDDL},
+		{query: "RENAME TABLE d.a TO d.b", kind: statementDDL},
+		{query: "TRUNCATE d.t", kind: statementDDL},
+
+		// Rejected.
+		{query: "", err: "Empty statement"},
+		{query: "-- just a comment", err: "Empty statement"},
+		{query: "SELECT 1; DROP TABLE d.t", err: "Multiple statements"},
+		{query: "SELECT 1;;", err: "Multiple statements"},
+		{query: "SELECT /*! SLEEP(10) */ 1", err: "executable comments"},
+		{query: "SELECT 'open", err: "unterminated"},
+		{query: "SELECT LOAD_FILE('/etc/passwd')", err: "LOAD_FILE"},
+		{query: "select load_file ('/etc/passwd')", err: "LOAD_FILE"},
+		{query: "SELECT * FROM d.t INTO OUTFILE '/tmp/t'", err: "INTO OUTFILE"},
+		{query: "SELECT * FROM d.t INTO DUMPFILE '/tmp/t'", err: "INTO DUMPFILE"},
+		{query: "SELECT a INTO @a FROM d.t", err: "SELECT ... INTO"},
+		{query: "INSERT INTO d.t (a) VALUES (NOW())", err: "NOW is not deterministic"},
+		{query: "UPDATE d.t SET a = CURRENT_TIMESTAMP", err: "CURRENT_TIMESTAMP is not deterministic"},
+		{query: "INSERT INTO d.t (id) VALUES (UUID ())", err: "UUID is not deterministic"},
+		{query: "DROP TABLE ?", err: "do not take parameters"},
+		{query: "CREATE USER x", err: "CREATE USER statements are not allowed"},
+		{query: "CREATE TEMPORARY TABLE d.t (a INT)", err: "CREATE TEMPORARY statements are not allowed"},
+		{query: "DROP TRIGGER d.tr", err: "DROP TRIGGER statements are not allowed"},
+		{query: "GRANT ALL ON *.* TO x", err: "GRANT statements are not allowed"},
+		{query: "EXPLAIN ANALYZE DELETE FROM d.t", err: "EXPLAIN ANALYZE"},
+		{query: "WITH c AS (SELECT 1) INSERT INTO d.t SELECT * FROM c", err: "SELECT ... INTO"},
+		{query: "WITH c AS (SELECT 1) TRUNCATE d.t", err: "WITH must be followed"},
+		{query: "(SELECT 1)", err: "must start with a keyword"},
+		{query: "INSERT INTO _cluster.named_queries (name) VALUES ('x')", err: "_cluster schema"},
+		{query: "UPDATE `_cluster`.`schema_versions` SET version = 1", err: "_cluster schema"},
+		{query: "DROP DATABASE _CLUSTER", err: "_cluster schema"},
+		{query: "INSERT INTO d.t SELECT * FROM _cluster.migrations", err: "_cluster schema"},
+	}
+	for _, tt := range tests {
+		kind, params, err := classifySQL(tt.query)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("classifySQL(%q) error = %v, want it to contain %q", tt.query, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("classifySQL(%q): %v", tt.query, err)
+			continue
+		}
+		if kind != tt.kind || params != tt.params {
+			t.Errorf("classifySQL(%q) = %s, %d; want %s, %d", tt.query, kind, params, tt.kind, tt.params)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQuoteIdent(t *testing.T) {
+	valid := []string{"users", "Order_Items", "a$1", "_", "123", strings.Repeat("x", 64)}
+	for _, name := range valid {
+		got, err := quoteIdent(name)
+		if err != nil || got != "`"+name+"`" {
+			t.Errorf("quoteIdent(%q) = %q, %v", name, got, err)
+		}
+	}
+
+	invalid := []string{"", strings.Repeat("x", 65), "a b", "a`b", "a.b", "a-b", "t;DROP", "naïve", "a\x00"}
+	for _, name := range invalid {
+		if got, err := quoteIdent(name); err == nil {
+			t.Errorf("quoteIdent(%q) = %q, want an error", name, got)
+		}
+	}
+
+	if got, err := qualifiedTable("shop", "orders"); err != nil || got != "`shop`.`orders`" {
+		t.Errorf("qualifiedTable = %q, %v", got, err)
+	}
+	if _, err := qualifiedTable("shop", "orders`; DROP"); err == nil {
+		t.Error("qualifiedTable accepted an invalid table name")
+	}
+	if got, err := writableTable("shop", "orders"); err != nil || got != "`shop`.`orders`" {
+		t.Errorf("writableTable = %q, %v", got, err)
+	}
+	for _, dbname := range []string{"_cluster", "_CLUSTER", "shop`"} {
+		if _, err := writableTable(dbname, "orders"); err == nil {
+			t.Errorf("writableTable(%q) accepted a schema that cannot be written", dbname)
+		}
+	}
+}
+
+// decodeFilter decodes a filter the way the endpoints do, keeping numbers
+// as json.Number.
+func decodeFilter(t *testing.T, data string) filter {
+	t.Helper()
+	var f filter
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&f); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+	return f
+}
+
+func TestFilterBuild(t *testing.T) {
+	tests := []struct {
+		filter string
+		sql    string
+		args   []interface{}
+	}{
+		{`{"column": "id", "op": "eq", "value": 1}`, "`id` = ?", []interface{}{"1"}},
+		{`{"column": "price", "op": "gte", "value": 12345678901234567890.5}`, "`price` >= ?", []interface{}{"12345678901234567890.5"}},
+		{`{"column": "name", "op": "like", "value": "A%"}`, "`name` LIKE ?", []interface{}{"A%"}},
+		{`{"column": "name", "op": "ne", "value": "x' OR 1=1 --"}`, "`name` <> ?", []interface{}{"x' OR 1=1 --"}},
+		{`{"column": "tags", "op": "eq", "value": {"a": [1]}}`, "`tags` = ?", []interface{}{`{"a":[1]}`}},
+		{`{"column": "email", "op": "isnull"}`, "`email` IS NULL", nil},
+		{`{"column": "email", "op": "notnull"}`, "`email` IS NOT NULL", nil},
+		{`{"column": "id", "op": "in", "value": [1, 2, 3]}`, "`id` IN (?, ?, ?)", []interface{}{"1", "2", "3"}},
+		{`{"column": "id", "op": "nin", "value": ["a"]}`, "`id` NOT IN (?)", []interface{}{"a"}},
+		{
+			`{"and": [{"column": "a", "op": "lt", "value": 1}, {"or": [{"column": "b", "op": "gt", "value": 2}, {"not": {"column": "c", "op": "isnull"}}]}]}`,
+			"(`a` < ?) AND ((`b` > ?) OR (NOT (`c` IS NULL)))",
+			[]interface{}{"1", "2"},
+		},
+	}
+	for _, tt := range tests {
+		sql, args, err := decodeFilter(t, tt.filter).build()
+		if err != nil {
+			t.Errorf("build(%s): %v", tt.filter, err)
+			continue
+		}
+		if sql != tt.sql || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("build(%s) = %q, %v; want %q, %v", tt.filter, sql, args, tt.sql, tt.args)
+		}
+	}
+
+	invalid := []string{
+		`{"column": "id", "op": "between", "value": 1}`,
+		`{"column": "id", "op": "eq"}`,
+		`{"column": "id", "op": "in", "value": []}`,
+		`{"column": "id", "op": "in", "value": 1}`,
+		`{"column": "id = 1 OR 1", "op": "eq", "value": 1}`,
+		`{"column": "", "op": "isnull"}`,
+		`{"and": []}`,
+		`{"or": [{"column": "a", "op": "eq", "value": 1}, {"column": "b", "op": "nope", "value": 1}]}`,
+		`{"not": {"column": "a;", "op": "isnull"}}`,
+	}
+	for _, data := range invalid {
+		if sql, _, err := decodeFilter(t, data).build(); err == nil {
+			t.Errorf("build(%s) = %q, want an error", data, sql)
+		}
+	}
+}
+
+func TestBuildWrites(t *testing.T) {
+	values := map[string]interface{}{"name": "Ann", "age": json.Number("41"), "id": json.Number("7")}
+	sql, args, err := buildInsert(insertRequest{DBName: "shop", Table: "users", Values: values})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Columns are sorted so every node runs the same statement.
+	if want := "INSERT INTO `shop`.`users` (`age`, `id`, `name`) VALUES (?, ?, ?)"; sql != want {
+		t.Errorf("buildInsert = %q, want %q", sql, want)
+	}
+	if want := []interface{}{"41", "7", "Ann"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("buildInsert args = %v, want %v", args, want)
+	}
+
+	where := filter{Column: "id", Op: "eq", Value: json.Number("7")}
+	sql, args, err = buildUpdate(updateRequest{DBName: "shop", Table: "users", Set: map[string]interface{}{"name": "Bo"}, Where: &where})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "UPDATE `shop`.`users` SET `name` = ? WHERE `id` = ?"; sql != want || !reflect.DeepEqual(args, []interface{}{"Bo", "7"}) {
+		t.Errorf("buildUpdate = %q, %v", sql, args)
+	}
+
+	invalid := map[string]func() (string, []interface{}, error){
+		"insert without values": func() (string, []interface{}, error) {
+			return buildInsert(insertRequest{DBName: "shop", Table: "users"})
+		},
+		"insert with a bad column": func() (string, []interface{}, error) {
+			return buildInsert(insertRequest{DBName: "shop", Table: "users", Values: map[string]interface{}{"a b": 1}})
+		},
+		"insert of the row version": func() (string, []interface{}, error) {
+			return buildInsert(insertRequest{DBName: "shop", Table: "users", Values: map[string]interface{}{"_Version": 1}})
+		},
+		"update without where": func() (string, []interface{}, error) {
+			return buildUpdate(updateRequest{DBName: "shop", Table: "users", Set: map[string]interface{}{"name": "x"}})
+		},
+		"update of the row version": func() (string, []interface{}, error) {
+			return buildUpdate(updateRequest{DBName: "shop", Table: "users", Set: map[string]interface{}{versionColumn: 2}, Where: &where})
+		},
+		"delete without where": func() (string, []interface{}, error) {
+			return buildDelete(deleteRequest{DBName: "shop", Table: "users"})
+		},
+		"insert into the cluster schema": func() (string, []interface{}, error) {
+			return buildInsert(insertRequest{DBName: "_cluster", Table: "named_queries", Values: values})
+		},
+		"update of the cluster schema": func() (string, []interface{}, error) {
+			return buildUpdate(updateRequest{DBName: "_Cluster", Table: "schema_versions", Set: map[string]interface{}{"version": 1}, Where: &where})
+		},
+		"delete from the cluster schema": func() (string, []interface{}, error) {
+			return buildDelete(deleteRequest{DBName: "_CLUSTER", Table: "migrations", Where: &where})
+		},
+	}
+	for name, build := range invalid {
+		if sql, _, err := build(); err == nil {
+			t.Errorf("%s: built %q, want an error", name, sql)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Streamed results are flushed to the client after this many rows, and at
+// least this often while rows arrive slowly.
+const (
+	streamFlushRows     = 100
+	streamFlushInterval = 250 * time.Millisecond
+)
+
+// streamFlusher flushes a streamed response every streamFlushRows rows and,
+// from its own goroutine, streamFlushInterval after a row that is still
+// buffered, so a row followed by a pause reaches the client without waiting
+// for the next one. Rows are written through write, which holds the same
+// lock as the periodic flush.
+type streamFlusher struct {
+	mu      sync.Mutex
+	flush   func()
+	rows    int // written since the last flush
+	stopped bool
+	done    chan struct{}
+}
+
+func newStreamFlusher(flush func()) *streamFlusher {
+	f := &streamFlusher{flush: flush, done: make(chan struct{})}
+	go f.run()
+	return f
+}
+
+func (f *streamFlusher) run() {
+	ticker := time.NewTicker(streamFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			f.mu.Lock()
+			if !f.stopped && f.rows > 0 {
+				f.flush()
+				f.rows = 0
+			}
+			f.mu.Unlock()
+		}
+	}
+}
+
+// write runs writeRow, which writes one row, under the flush lock.
+func (f *streamFlusher) write(writeRow func() error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := writeRow(); err != nil {
+		return err
+	}
+	f.rows++
+	if f.rows >= streamFlushRows {
+		f.flush()
+		f.rows = 0
+	}
+	return nil
+}
+
+// stop ends the periodic flushing. Once it returns, the response is the
+// caller's alone again. It may be called more than once.
+func (f *streamFlusher) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.stopped {
+		f.stopped = true
+		close(f.done)
+	}
+}
+
+// streamErrorTrailer reports a failure that happened after the status line
+// and some rows were already sent.
+const streamErrorTrailer = "X-Stream-Error"
+
+// streamRecords writes the rows of query as they are scanned instead of
+// collecting them first, so memory stays bounded for large tables. The
+// format is "ndjson" (one JSON object per line, with the column metadata in
+// the X-Result-Columns header) or "json" (the {"columns", "rows"} object of
+// /select, sent in chunks). Values are decoded as in scanResult. A
+// mid-stream failure is reported in the X-Stream-Error trailer; NDJSON
+// additionally ends with an {"error": ...} line, and a JSON object is left
+// unterminated so the client cannot mistake it for a result.
+func streamRecords(w http.ResponseWriter, r *http.Request, format, query string, args []interface{}) {
+	rows, err := dbQuery(r.Context(), query, args...)
+	if err != nil {
+		http.Error(w, "Failed to query records: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		http.Error(w, "Failed to get columns: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	columns := resultColumns(types)
+
+	if format == "ndjson" {
+		meta, _ := json.Marshal(columns)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("X-Result-Columns", string(meta))
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("Trailer", streamErrorTrailer)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	fail := func(err error) {
+		loggerFrom(r.Context()).Error("Streaming select failed", "error", err)
+		w.Header().Set(streamErrorTrailer, err.Error())
+		if format == "ndjson" {
+			enc.Encode(map[string]string{"error": err.Error()})
+		}
+	}
+
+	if format == "json" {
+		meta, _ := json.Marshal(columns)
+		w.Write([]byte(`{"columns":` + string(meta) + `,"rows":[`))
+	}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	n := 0
+	flusher := newStreamFlusher(func() { rc.Flush() })
+	defer flusher.stop()
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			flusher.stop()
+			fail(err)
+			return
+		}
+		row := decodeRow(columns, values)
+
+		err := flusher.write(func() error {
+			if format == "json" && n > 0 {
+				w.Write([]byte(","))
+			}
+			return enc.Encode(row)
+		})
+		if err != nil {
+			// The client went away; there is nobody left to tell.
+			return
+		}
+		n++
+	}
+	flusher.stop()
+	if err := rows.Err(); err != nil {
+		fail(err)
+		return
+	}
+	if format == "json" {
+		w.Write([]byte("]}\n"))
+	}
+}
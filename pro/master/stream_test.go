@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStreamFlusher(t *testing.T) {
+	var flushes atomic.Int32
+	f := newStreamFlusher(func() { flushes.Add(1) })
+	defer f.stop()
+
+	// A lone row is flushed within the interval, without a following row.
+	if err := f.write(func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * streamFlushInterval)
+	for flushes.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if flushes.Load() != 1 {
+		t.Fatalf("%d flushes after one slow row, want 1", flushes.Load())
+	}
+
+	// Nothing is flushed while no row is buffered.
+	time.Sleep(2 * streamFlushInterval)
+	if flushes.Load() != 1 {
+		t.Errorf("%d flushes without new rows, want 1", flushes.Load())
+	}
+
+	// A full batch is flushed without waiting for the interval.
+	before := flushes.Load()
+	for i := 0; i < streamFlushRows; i++ {
+		f.write(func() error { return nil })
+	}
+	if flushes.Load() == before {
+		t.Errorf("no flush after %d rows", streamFlushRows)
+	}
+
+	// After stop, a buffered row is left to the caller.
+	f.write(func() error { return nil })
+	f.stop()
+	stopped := flushes.Load()
+	time.Sleep(2 * streamFlushInterval)
+	if flushes.Load() != stopped {
+		t.Errorf("%d flushes after stop, want none", flushes.Load()-stopped)
+	}
+}
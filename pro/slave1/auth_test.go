@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithAdminToken(t *testing.T) {
+	defer func(token string) { adminToken = token }(adminToken)
+	adminToken = "secret"
+
+	handler := withAdminToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	tests := []struct {
+		method, target, token string
+		want                  int
+	}{
+		// Untrusted clients cannot read tables directly, not even _cluster.
+		{http.MethodGet, "/select?dbname=shop&table=users", "", http.StatusUnauthorized},
+		{http.MethodGet, "/select?dbname=_cluster&table=named_queries", "", http.StatusUnauthorized},
+		{http.MethodPost, "/aggregate", "", http.StatusUnauthorized},
+		{http.MethodGet, "/export?dbname=shop&table=users", "", http.StatusUnauthorized},
+		{http.MethodGet, "/describe?dbname=shop&table=users", "", http.StatusUnauthorized},
+		{http.MethodGet, "/tables?dbname=shop", "", http.StatusUnauthorized},
+		{http.MethodGet, "/databases", "", http.StatusUnauthorized},
+		{http.MethodGet, "/cache", "", http.StatusUnauthorized},
+		{http.MethodGet, "/named-queries", "", http.StatusUnauthorized},
+		{http.MethodPost, "/query", "", http.StatusUnauthorized},
+		{http.MethodPost, "/insert", "", http.StatusUnauthorized},
+		{http.MethodPost, "/replicate/insert", "", http.StatusUnauthorized},
+		{http.MethodGet, "/select?dbname=shop&table=users", "wrong", http.StatusUnauthorized},
+
+		// Health checks and named queries are open.
+		{http.MethodGet, "/livez", "", http.StatusOK},
+		{http.MethodGet, "/readyz", "", http.StatusOK},
+		{http.MethodPost, "/call", "", http.StatusOK},
+		{http.MethodOptions, "/select", "", http.StatusOK},
+
+		// Admins can use everything.
+		{http.MethodGet, "/select?dbname=shop&table=users", "secret", http.StatusOK},
+		{http.MethodPost, "/insert", "secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s with token %q = %d, want %d", tt.method, tt.target, tt.token, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	defaultBulkChunkSize = 500
+	maxBulkChunkSize     = 5000
+
+	// chunkRowTimeout is the time a slave is given per replicated row, on
+	// top of the deadline of the load itself.
+	chunkRowTimeout = 2 * time.Millisecond
+
+	// appliedChunkRetention is how long a slave remembers the chunks it
+	// applied, which bounds how late a retry may arrive.
+	appliedChunkRetention = "7 DAY"
+)
+
+// bulkInsertRequest is the JSON body of /bulk-insert and /replicate/bulk-insert.
+// ChunkID identifies a replicated chunk, so a slave applies it only once
+// however often it is retried.
+type bulkInsertRequest struct {
+	DBName    string                   `json:"dbname"`
+	Table     string                   `json:"table"`
+	Rows      []map[string]interface{} `json:"rows"`
+	ChunkSize int                      `json:"chunkSize,omitempty"`
+	ChunkID   string                   `json:"chunkId,omitempty"`
+}
+
+// rowError reports why one input row was not inserted. Row numbers are
+// 1-based positions in the request (line numbers for NDJSON).
+type rowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// bulkResult summarizes a bulk load.
+type bulkResult struct {
+	Inserted int        `json:"inserted"`
+	Failed   int        `json:"failed"`
+	Chunks   int        `json:"chunks"`
+	Errors   []rowError `json:"errors"`
+}
+
+// numberedRow is an input row with its position in the request.
+type numberedRow struct {
+	n      int
+	values map[string]interface{}
+}
+
+// rollsBackTransaction reports whether MySQL aborted the whole transaction
+// when err occurred (deadlock or lock wait timeout), rather than just the
+// failing statement.
+func rollsBackTransaction(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && (mysqlErr.Number == 1213 || mysqlErr.Number == 1205)
+}
+
+// insertChunk inserts rows in a single transaction. A row that fails is
+// reported and skipped; the rest of the chunk still commits. The rows that
+// were committed are returned so they can be replicated as one operation.
+func insertChunk(ctx context.Context, dbname, table string, rows []numberedRow) ([]map[string]interface{}, []rowError) {
+	var errs []rowError
+	failAll := func(err error) ([]map[string]interface{}, []rowError) {
+		for _, row := range rows {
+			errs = append(errs, rowError{Row: row.n, Error: err.Error()})
+		}
+		return nil, errs
+	}
+
+	ctx, span := tracer.Start(ctx, "bulk-insert chunk")
+	defer span.End()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return failAll(fmt.Errorf("begin transaction: %w", err))
+	}
+
+	inserted := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		query, args, err := buildInsert(insertRequest{DBName: dbname, Table: table, Values: row.values})
+		if err == nil {
+			_, err = tx.ExecContext(ctx, tagQuery(ctx, query), args...)
+		}
+		if rollsBackTransaction(err) {
+			tx.Rollback()
+			errs = errs[:0]
+			return failAll(err)
+		}
+		if err != nil {
+			errs = append(errs, rowError{Row: row.n, Error: err.Error()})
+			continue
+		}
+		inserted = append(inserted, row.values)
+	}
+
+	if err := tx.Commit(); err != nil {
+		errs = errs[:0]
+		return failAll(fmt.Errorf("commit: %w", err))
+	}
+	resultCache.invalidate(dbname, table)
+	return inserted, errs
+}
+
+// loadRows inserts the rows produced by next in chunks of chunkSize,
+// replicating every committed chunk as a single /replicate/bulk-insert call.
+// next returns io.EOF when the input is exhausted; any other error is a
+// per-row error and loading continues.
+func loadRows(ctx context.Context, dbname, table string, chunkSize int, next func() (numberedRow, error)) bulkResult {
+	result := bulkResult{Errors: []rowError{}}
+	chunk := make([]numberedRow, 0, chunkSize)
+	loadID := randomHex(8)
+
+	flush := func() {
+		if len(chunk) == 0 {
+			return
+		}
+		inserted, errs := insertChunk(ctx, dbname, table, chunk)
+		result.Chunks++
+		result.Inserted += len(inserted)
+		result.Failed += len(errs)
+		result.Errors = append(result.Errors, errs...)
+		if len(inserted) > 0 {
+			timeout := requestTimeoutFrom(ctx) + time.Duration(len(inserted))*chunkRowTimeout
+			replicateToSlavesJSON(context.WithValue(ctx, requestTimeoutKey{}, timeout), "/replicate/bulk-insert", bulkInsertRequest{
+				DBName:  dbname,
+				Table:   table,
+				Rows:    inserted,
+				ChunkID: loadID + "-" + strconv.Itoa(result.Chunks),
+			})
+		}
+		chunk = chunk[:0]
+	}
+
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, rowError{Row: row.n, Error: err.Error()})
+			continue
+		}
+		chunk = append(chunk, row)
+		if len(chunk) == chunkSize {
+			flush()
+		}
+	}
+	flush()
+	return result
+}
+
+// bulkChunkSize validates a requested chunk size, applying the default.
+func bulkChunkSize(n int) (int, error) {
+	switch {
+	case n == 0:
+		return defaultBulkChunkSize, nil
+	case n < 0 || n > maxBulkChunkSize:
+		return 0, fmt.Errorf("chunkSize must be between 1 and %d", maxBulkChunkSize)
+	}
+	return n, nil
+}
+
+// bulkInsert loads many rows at once. It accepts either a JSON body
+// (bulkInsertRequest) or, with Content-Type application/x-ndjson, one JSON
+// object per line with dbname, table and chunkSize given as URL parameters.
+func bulkInsert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var dbname, table string
+	var chunkSize int
+	var next func() (numberedRow, error)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-ndjson") {
+		q := r.URL.Query()
+		dbname, table = q.Get("dbname"), q.Get("table")
+		if v := q.Get("chunkSize"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "Invalid chunkSize", http.StatusBadRequest)
+				return
+			}
+			chunkSize = n
+		}
+
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		line := 0
+		readFailed := false
+		next = func() (numberedRow, error) {
+			for scanner.Scan() {
+				line++
+				text := strings.TrimSpace(scanner.Text())
+				if text == "" {
+					continue
+				}
+				row := numberedRow{n: line}
+				dec := json.NewDecoder(strings.NewReader(text))
+				dec.UseNumber()
+				if err := dec.Decode(&row.values); err != nil {
+					return row, fmt.Errorf("invalid JSON: %v", err)
+				}
+				return row, nil
+			}
+			if err := scanner.Err(); err != nil && !readFailed {
+				readFailed = true
+				return numberedRow{n: line + 1}, fmt.Errorf("read body: %v", err)
+			}
+			return numberedRow{}, io.EOF
+		}
+	} else {
+		var req bulkInsertRequest
+		if err := decodeJSON(r, &req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		dbname, table, chunkSize = req.DBName, req.Table, req.ChunkSize
+		i := 0
+		next = func() (numberedRow, error) {
+			if i == len(req.Rows) {
+				return numberedRow{}, io.EOF
+			}
+			i++
+			return numberedRow{n: i, values: req.Rows[i-1]}, nil
+		}
+	}
+
+	if dbname == "" || table == "" {
+		http.Error(w, "Both dbname and table are required", http.StatusBadRequest)
+		return
+	}
+	if _, err := writableTable(dbname, table); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	chunkSize, err := bulkChunkSize(chunkSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := loadRows(detachWrite(r.Context()), dbname, table, chunkSize, next)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Bulk insert completed",
+		"inserted": result.Inserted,
+		"failed":   result.Failed,
+		"chunks":   result.Chunks,
+		"errors":   result.Errors,
+	})
+}
+
+// errChunkApplied is returned for a replicated chunk or transaction that this
+// slave has already applied.
+var errChunkApplied = errors.New("already applied")
+
+// recordChunk records id in tx, so the chunk it names is applied once: a
+// retry of a chunk that committed fails with errChunkApplied.
+func recordChunk(ctx context.Context, tx *sql.Tx, id string) error {
+	_, err := tx.ExecContext(ctx, tagQuery(ctx,
+		"INSERT INTO `"+clusterSchema+"`.`applied_chunks` (chunk_id) VALUES (?)"), id)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+		return errChunkApplied
+	}
+	return err
+}
+
+// pruneAppliedChunks forgets the chunks applied more than
+// appliedChunkRetention ago.
+func pruneAppliedChunks(ctx context.Context) {
+	if _, err := dbExec(ctx, "DELETE FROM `"+clusterSchema+"`.`applied_chunks` "+
+		"WHERE applied_at < NOW() - INTERVAL "+appliedChunkRetention); err != nil {
+		loggerFrom(ctx).Warn("Failed to prune applied chunks", "error", err)
+	}
+}
+
+// replicateBulkInsert applies a chunk committed on the master. The chunk is
+// applied atomically, together with a record of its ID, so a retried
+// replication never inserts half of it or inserts it twice.
+func replicateBulkInsert(w http.ResponseWriter, r *http.Request) {
+	var req bulkInsertRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.DBName == "" || req.Table == "" || len(req.Rows) == 0 {
+		http.Error(w, "All fields (dbname, table, rows) are required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "Failed to begin transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if req.ChunkID != "" {
+		err := recordChunk(r.Context(), tx, req.ChunkID)
+		if errors.Is(err, errChunkApplied) {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message":      "Chunk already applied",
+				"rowsAffected": 0,
+			})
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to record chunk: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	for i, values := range req.Rows {
+		query, args, err := buildInsert(insertRequest{DBName: req.DBName, Table: req.Table, Values: values})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Row %d: %v", i+1, err), http.StatusBadRequest)
+			return
+		}
+		if _, err := tx.ExecContext(r.Context(), tagQuery(r.Context(), query), args...); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to insert row %d: %v", i+1, err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resultCache.invalidate(req.DBName, req.Table)
+	if req.ChunkID != "" {
+		pruneAppliedChunks(r.Context())
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Rows inserted successfully",
+		"rowsAffected": len(req.Rows),
+	})
+}
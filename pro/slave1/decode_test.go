@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeValue(t *testing.T) {
+	tests := []struct {
+		raw    string
+		dbType string
+		want   interface{}
+	}{
+		{"2024-05-01 12:30:00", "DATETIME", "2024-05-01T12:30:00"},
+		{"2024-05-01 12:30:00.250000", "DATETIME", "2024-05-01T12:30:00.25"},
+		{"2024-05-01 12:30:00", "TIMESTAMP", "2024-05-01T12:30:00Z"},
+		{"0000-00-00 00:00:00", "DATETIME", "0000-00-00 00:00:00"},
+		{"-12", "INT", int64(-12)},
+		{"18446744073709551615", "UNSIGNED BIGINT", uint64(18446744073709551615)},
+		{"12.50", "DECIMAL", "12.50"},
+		{`{"a": 1}`, "JSON", json.RawMessage(`{"a": 1}`)},
+		{"\x01\x02", "BIT", uint64(258)},
+		{"\xff", "BLOB", []byte{0xff}},
+	}
+	for _, tt := range tests {
+		if got := decodeValue([]byte(tt.raw), tt.dbType); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeValue(%q, %s) = %#v, want %#v", tt.raw, tt.dbType, got, tt.want)
+		}
+	}
+}
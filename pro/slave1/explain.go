@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// explainRequest is the POST body of /explain: either the body of a /select
+// request under "select", or a read statement as sent to /query.
+type explainRequest struct {
+	Select *selectRequest `json:"select,omitempty"`
+	sqlRequest
+}
+
+// planTable is the optimizer's choice for one table of a plan.
+type planTable struct {
+	Table        string   `json:"table"`
+	Access       string   `json:"access"`
+	Index        string   `json:"index,omitempty"`
+	PossibleKeys []string `json:"possibleKeys,omitempty"`
+	RowsExamined int64    `json:"rowsExamined"`
+	RowsProduced int64    `json:"rowsProduced"`
+	Filtered     float64  `json:"filtered"`
+	Condition    string   `json:"condition,omitempty"`
+}
+
+// planSummary condenses an EXPLAIN FORMAT=JSON document. EstimatedRows is
+// the number of rows the optimizer expects the query to produce before any
+// grouping or LIMIT is applied. Tables lists every table access, including
+// those of subqueries and derived tables; it is not in execution order.
+type planSummary struct {
+	Cost          float64     `json:"cost"`
+	EstimatedRows int64       `json:"estimatedRows"`
+	Tables        []planTable `json:"tables"`
+	Filesort      bool        `json:"filesort"`
+	TempTable     bool        `json:"temporaryTable"`
+	Warnings      []string    `json:"warnings"`
+}
+
+// explainQuery shows the plan MySQL would use for a read without running it.
+// GET takes the parameters of GET /select; POST takes an explainRequest. Like
+// /query, explaining ad hoc SQL needs the admin token.
+func explainQuery(w http.ResponseWriter, r *http.Request) {
+	var query string
+	var args []interface{}
+	switch r.Method {
+	case http.MethodGet:
+		req, err := parseSelectRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		status := 0
+		if query, args, status, err = explainSelect(r, req); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	case http.MethodPost:
+		var req explainRequest
+		if err := decodeJSON(r, &req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if (req.Select == nil) == (req.SQL == "") {
+			http.Error(w, "Exactly one of select or sql is required", http.StatusBadRequest)
+			return
+		}
+		if req.Select != nil {
+			status := 0
+			var err error
+			if query, args, status, err = explainSelect(r, *req.Select); err != nil {
+				http.Error(w, err.Error(), status)
+				return
+			}
+			break
+		}
+		if !requireAdmin(w, r) {
+			return
+		}
+		kind, params, err := req.prepare()
+		if err == nil && kind != statementRead {
+			err = errors.New("Only reads can be explained")
+		}
+		if err == nil {
+			err = explainable(req.SQL)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query, args = req.SQL, params
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var plan string
+	if err := dbQueryRow(r.Context(), "EXPLAIN FORMAT=JSON "+query, args...).Scan(&plan); err != nil {
+		http.Error(w, "Failed to explain query: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	summary, err := summarizePlan([]byte(plan))
+	if err != nil {
+		http.Error(w, "Failed to read query plan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if args == nil {
+		args = []interface{}{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sql":     query,
+		"params":  args,
+		"plan":    json.RawMessage(plan),
+		"summary": summary,
+	})
+}
+
+// explainSelect builds the statement /select would run for req.
+func explainSelect(r *http.Request, req selectRequest) (string, []interface{}, int, error) {
+	if req.Keyset || req.Cursor != "" {
+		page, status, err := newKeysetPage(r.Context(), req)
+		if err != nil {
+			return "", nil, status, err
+		}
+		query, args, err := page.buildSelect(req)
+		if err != nil {
+			return "", nil, http.StatusBadRequest, err
+		}
+		return query, args, 0, nil
+	}
+	query, args, err := buildSelect(req)
+	if err != nil {
+		return "", nil, http.StatusBadRequest, err
+	}
+	return query, args, 0, nil
+}
+
+// explainable rejects reads EXPLAIN does not accept, such as SHOW or another
+// EXPLAIN.
+func explainable(query string) error {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return err
+	}
+	switch tokens[0].text {
+	case "SELECT", "WITH", "TABLE":
+		return nil
+	}
+	return fmt.Errorf("%s statements cannot be explained", tokens[0].text)
+}
+
+// summarizePlan walks a plan in MySQL's JSON format, collecting every table
+// access and flagging the expensive ones.
+func summarizePlan(plan []byte) (planSummary, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(plan, &doc); err != nil {
+		return planSummary{}, err
+	}
+	summary := planSummary{Tables: []planTable{}, Warnings: []string{}}
+	if block, ok := doc["query_block"].(map[string]interface{}); ok {
+		if cost, ok := block["cost_info"].(map[string]interface{}); ok {
+			summary.Cost = planNumber(cost["query_cost"])
+		}
+		summary.EstimatedRows = outputRows(block)
+	}
+	walkPlan(doc, &summary)
+
+	for _, t := range summary.Tables {
+		switch t.Access {
+		case "ALL":
+			msg := fmt.Sprintf("Full table scan on %s (about %d rows)", t.Table, t.RowsExamined)
+			if len(t.PossibleKeys) == 0 {
+				msg += "; no index matches the filter"
+			}
+			summary.Warnings = append(summary.Warnings, msg)
+		case "index":
+			summary.Warnings = append(summary.Warnings,
+				fmt.Sprintf("Full index scan on %s using %s (about %d rows)", t.Table, t.Index, t.RowsExamined))
+		}
+	}
+	if summary.Filesort {
+		summary.Warnings = append(summary.Warnings, "Rows are sorted with a filesort; an index on the order columns avoids it")
+	}
+	if summary.TempTable {
+		summary.Warnings = append(summary.Warnings, "A temporary table is used")
+	}
+	return summary, nil
+}
+
+// outputRows estimates the rows a query block produces: those its last
+// joined table produces, found below the operations wrapping the join. A
+// UNION produces the rows of all its parts. Subqueries and derived tables
+// hang off the tables and do not count.
+func outputRows(block map[string]interface{}) int64 {
+	for block != nil {
+		if t, ok := block["table"].(map[string]interface{}); ok {
+			return int64(planNumber(t["rows_produced_per_join"]))
+		}
+		if loop, ok := block["nested_loop"].([]interface{}); ok && len(loop) > 0 {
+			last, _ := loop[len(loop)-1].(map[string]interface{})
+			t, _ := last["table"].(map[string]interface{})
+			return int64(planNumber(t["rows_produced_per_join"]))
+		}
+		if union, ok := block["union_result"].(map[string]interface{}); ok {
+			var n int64
+			specs, _ := union["query_specifications"].([]interface{})
+			for _, spec := range specs {
+				spec, _ := spec.(map[string]interface{})
+				inner, _ := spec["query_block"].(map[string]interface{})
+				n += outputRows(inner)
+			}
+			return n
+		}
+		var next map[string]interface{}
+		for _, op := range []string{"ordering_operation", "grouping_operation", "duplicates_removal", "windowing", "buffer_result"} {
+			if m, ok := block[op].(map[string]interface{}); ok {
+				next = m
+				break
+			}
+		}
+		block = next
+	}
+	return 0
+}
+
+func walkPlan(node interface{}, summary *planSummary) {
+	switch node := node.(type) {
+	case []interface{}:
+		for _, child := range node {
+			walkPlan(child, summary)
+		}
+	case map[string]interface{}:
+		if name, ok := node["table_name"].(string); ok {
+			t := planTable{
+				Table:        name,
+				Access:       planString(node["access_type"]),
+				Index:        planString(node["key"]),
+				RowsExamined: int64(planNumber(node["rows_examined_per_scan"])),
+				RowsProduced: int64(planNumber(node["rows_produced_per_join"])),
+				Filtered:     planNumber(node["filtered"]),
+				Condition:    planString(node["attached_condition"]),
+			}
+			if keys, ok := node["possible_keys"].([]interface{}); ok {
+				for _, k := range keys {
+					t.PossibleKeys = append(t.PossibleKeys, planString(k))
+				}
+			}
+			summary.Tables = append(summary.Tables, t)
+		}
+		if v, _ := node["using_filesort"].(bool); v {
+			summary.Filesort = true
+		}
+		if v, _ := node["using_temporary_table"].(bool); v {
+			summary.TempTable = true
+		}
+		// Map order is random; sort the keys so the tables keep a stable order.
+		keys := make([]string, 0, len(node))
+		for k := range node {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			walkPlan(node[k], summary)
+		}
+	}
+}
+
+func planString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// planNumber reads a plan figure, which MySQL writes as a number or a string.
+func planNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+	return 0
+}
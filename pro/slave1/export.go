@@ -0,0 +1,290 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFormats maps an /export format to its content type and extension.
+var exportFormats = map[string][2]string{
+	"csv":   {"text/csv; charset=utf-8", "csv"},
+	"jsonl": {"application/x-ndjson", "jsonl"},
+	"sql":   {"application/sql", "sql"},
+}
+
+// rowEncoder writes exported rows in one format.
+type rowEncoder interface {
+	encode(values []interface{}) error
+	end() error
+}
+
+// exportText renders a scanned value as plain text.
+func exportText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999")
+	}
+	return fmt.Sprint(v)
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	fields []string
+}
+
+func (e *csvEncoder) encode(values []interface{}) error {
+	for i, v := range values {
+		e.fields[i] = exportText(v)
+	}
+	return e.w.Write(e.fields)
+}
+
+func (e *csvEncoder) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// jsonlEncoder writes one object per row, decoded as in /select.
+type jsonlEncoder struct {
+	enc     *json.Encoder
+	columns []columnInfo
+}
+
+func (e *jsonlEncoder) encode(values []interface{}) error {
+	return e.enc.Encode(decodeRow(e.columns, values))
+}
+
+func (e *jsonlEncoder) end() error { return nil }
+
+// sqlEncoder writes one INSERT statement per row. The table name is
+// qualified with its database, so loading the dump does not depend on the
+// current database.
+type sqlEncoder struct {
+	w      io.Writer
+	prefix string
+	types  []string
+}
+
+// sqlLiteral renders v as a MySQL literal for a column of type dbType.
+func sqlLiteral(v interface{}, dbType string) string {
+	if v == nil {
+		return "NULL"
+	}
+	b, isBytes := v.([]byte)
+	switch {
+	case strings.Contains(dbType, "BLOB") || strings.Contains(dbType, "BINARY") || dbType == "BIT" || dbType == "GEOMETRY":
+		if !isBytes {
+			b = []byte(exportText(v))
+		}
+		if len(b) == 0 {
+			return "''"
+		}
+		return "X'" + hex.EncodeToString(b) + "'"
+	case strings.Contains(dbType, "INT") || dbType == "DECIMAL" || dbType == "FLOAT" || dbType == "DOUBLE" || dbType == "YEAR":
+		return exportText(v)
+	}
+
+	s := exportText(v)
+	var sb strings.Builder
+	sb.Grow(len(s) + 2)
+	sb.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case 0:
+			sb.WriteString(`\0`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case 0x1a:
+			sb.WriteString(`\Z`)
+		case '\'', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
+
+func (e *sqlEncoder) encode(values []interface{}) error {
+	literals := make([]string, len(values))
+	for i, v := range values {
+		literals[i] = sqlLiteral(v, e.types[i])
+	}
+	_, err := io.WriteString(e.w, e.prefix+strings.Join(literals, ", ")+");\n")
+	return err
+}
+
+func (e *sqlEncoder) end() error { return nil }
+
+// exportTable streams a table, or the rows matched by a /select-style
+// filter, as a downloadable file. The selection is read like /select (URL
+// parameters on GET, a JSON body on POST); the output is chosen with URL
+// parameters:
+//
+//	format  csv (default), jsonl or sql
+//	gzip    "true" to compress the file (served as application/gzip)
+//
+// Like streamed selects, a failure after the first bytes were sent is
+// reported in the X-Stream-Error trailer.
+func exportTable(w http.ResponseWriter, r *http.Request) {
+	req, err := parseSelectRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Keyset || req.Cursor != "" {
+		http.Error(w, "keyset pagination is not supported by /export", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	info, ok := exportFormats[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("invalid format %q (expected csv, jsonl or sql)", format), http.StatusBadRequest)
+		return
+	}
+	compress := false
+	if v := q.Get("gzip"); v != "" {
+		if compress, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid gzip %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	query, args, err := buildSelect(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rows, err := dbQuery(r.Context(), query, args...)
+	if err != nil {
+		http.Error(w, "Failed to query records: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		http.Error(w, "Failed to get columns: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	columns := resultColumns(types)
+	cols := make([]string, len(columns))
+	dbTypes := make([]string, len(columns))
+	for i, col := range columns {
+		cols[i] = col.Name
+		dbTypes[i] = col.Type
+	}
+
+	filename := req.Table + "." + info[1]
+	contentType := info[0]
+	if compress {
+		filename += ".gz"
+		contentType = "application/gzip"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Trailer", streamErrorTrailer)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	var out io.Writer = w
+	var gz *gzip.Writer
+	gzClosed := false
+	// closeGzip ends the gzip stream; every return path needs it for the
+	// client to receive a complete file.
+	closeGzip := func() {
+		if gz != nil && !gzClosed {
+			gzClosed = true
+			gz.Close()
+		}
+	}
+	defer closeGzip()
+	if compress {
+		gz = gzip.NewWriter(w)
+		out = gz
+	}
+	flush := func(enc rowEncoder) {
+		enc.end()
+		if gz != nil {
+			gz.Flush()
+		}
+		http.NewResponseController(w).Flush()
+	}
+	var enc rowEncoder
+	fail := func(err error) {
+		loggerFrom(r.Context()).Error("Export failed", "error", err)
+		enc.end()
+		if format == "sql" {
+			fmt.Fprintf(out, "-- export failed: %s\n", strings.ReplaceAll(err.Error(), "\n", " "))
+		}
+		closeGzip()
+		w.Header().Set(streamErrorTrailer, err.Error())
+	}
+
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(out)
+		if err := cw.Write(cols); err != nil {
+			return
+		}
+		enc = &csvEncoder{w: cw, fields: make([]string, len(cols))}
+	case "jsonl":
+		enc = &jsonlEncoder{enc: json.NewEncoder(out), columns: columns}
+	case "sql":
+		quoted := make([]string, len(cols))
+		for i, col := range cols {
+			quoted[i] = "`" + strings.ReplaceAll(col, "`", "``") + "`"
+		}
+		table, _ := qualifiedTable(req.DBName, req.Table)
+		fmt.Fprintf(out, "-- Export of %s.%s\n", req.DBName, req.Table)
+		enc = &sqlEncoder{
+			w:      out,
+			prefix: "INSERT INTO " + table + " (" + strings.Join(quoted, ", ") + ") VALUES (",
+			types:  dbTypes,
+		}
+	}
+
+	values := make([]interface{}, len(cols))
+	pointers := make([]interface{}, len(cols))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	flusher := newStreamFlusher(func() { flush(enc) })
+	defer flusher.stop()
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			flusher.stop()
+			fail(err)
+			return
+		}
+		if err := flusher.write(func() error { return enc.encode(values) }); err != nil {
+			// The client went away.
+			return
+		}
+	}
+	flusher.stop()
+	if err := rows.Err(); err != nil {
+		fail(err)
+		return
+	}
+	enc.end()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLeaderStateConcurrency(t *testing.T) {
+	defer func(master bool, address string, slaves []string) {
+		isMaster, masterAddress, slaveAddresses, electionInProgress = master, address, slaves, false
+	}(leaderState())
+	stepDown("http://old:8001")
+
+	// An election and /promote racing to promote the node claim it once.
+	var claimed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if claimMaster("http://self:8002") {
+				claimed.Add(1)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			promoteRequest{Slaves: []string{"http://other:8003"}}.takeOver(httptest.NewRequest(http.MethodPost, "/promote", nil))
+			if len(currentSlaves()) != 1 {
+				t.Error("currentSlaves did not return the adopted slave list")
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed.Load() != 1 {
+		t.Errorf("claimMaster succeeded %d times, want once", claimed.Load())
+	}
+	if master, address, _ := leaderState(); !master || address != "http://self:8002" {
+		t.Errorf("leaderState = %v, %q; want the master at http://self:8002", master, address)
+	}
+
+	if follow("http://other:8003") {
+		t.Error("follow succeeded on the master")
+	}
+	stepDown("http://other:8003")
+	if !follow("http://third:8004") || currentMaster() != "http://third:8004" {
+		t.Errorf("follow did not switch masters; master is %q", currentMaster())
+	}
+
+	if !beginElection() || beginElection() {
+		t.Error("beginElection did not allow exactly one election")
+	}
+	endElection()
+	if !beginElection() {
+		t.Error("beginElection refused an election after endElection")
+	}
+}
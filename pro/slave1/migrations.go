@@ -0,0 +1,532 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clusterSchema is the metadata database every node keeps locally. It is
+// created at startup and hidden from /databases.
+const clusterSchema = "_cluster"
+
+// migrateMu serializes migrations, rollbacks and their replication on a node.
+var migrateMu sync.Mutex
+
+// errSchemaMismatch means this node's schema versions differ from the leader's.
+var errSchemaMismatch = errors.New("schema version mismatch")
+
+// ensureClusterSchema creates the metadata database and tables if needed.
+func ensureClusterSchema(ctx context.Context) error {
+	for _, stmt := range []string{
+		"CREATE DATABASE IF NOT EXISTS `" + clusterSchema + "`",
+		"CREATE TABLE IF NOT EXISTS `" + clusterSchema + "`.`migrations` (" +
+			"dbname VARCHAR(64) NOT NULL, version INT NOT NULL, name VARCHAR(255) NOT NULL, " +
+			"up_sql MEDIUMTEXT NOT NULL, down_sql MEDIUMTEXT NOT NULL, " +
+			"PRIMARY KEY (dbname, version))",
+		"CREATE TABLE IF NOT EXISTS `" + clusterSchema + "`.`schema_versions` (" +
+			"dbname VARCHAR(64) NOT NULL PRIMARY KEY, version INT NOT NULL, " +
+			"updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP)",
+		"CREATE TABLE IF NOT EXISTS `" + clusterSchema + "`.`named_queries` (" +
+			"name VARCHAR(64) NOT NULL PRIMARY KEY, sql_text MEDIUMTEXT NOT NULL, " +
+			"params TEXT NOT NULL, description TEXT NOT NULL)",
+		"CREATE TABLE IF NOT EXISTS `" + clusterSchema + "`.`applied_chunks` (" +
+			"chunk_id VARCHAR(64) NOT NULL PRIMARY KEY, " +
+			"applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, KEY (applied_at))",
+	} {
+		if _, err := dbExec(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migration is a registered, numbered schema change of one database.
+type migration struct {
+	DBName  string `json:"dbname"`
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Up      string `json:"up"`
+	Down    string `json:"down,omitempty"`
+}
+
+// validate checks the migration's fields and that every statement of its
+// scripts is DDL or deterministic DML.
+func (m migration) validate() error {
+	if m.DBName == "" || m.Version <= 0 || m.Name == "" || strings.TrimSpace(m.Up) == "" {
+		return errors.New("All fields (dbname, version > 0, name, up) are required")
+	}
+	if err := writableSchema(m.DBName); err != nil {
+		return err
+	}
+	for label, script := range map[string]string{"up": m.Up, "down": m.Down} {
+		statements, err := splitStatements(script)
+		if err != nil {
+			return fmt.Errorf("%s: %v", label, err)
+		}
+		for i, stmt := range statements {
+			kind, params, err := classifySQL(stmt)
+			if err == nil && kind == statementRead {
+				err = errors.New("read statements are not allowed")
+			}
+			if err == nil && params > 0 {
+				err = errors.New("placeholders are not allowed")
+			}
+			if err != nil {
+				return fmt.Errorf("%s statement %d: %v", label, i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// migrationStep is one migration applied in one direction. It is what the
+// master replicates; From and To let a replica detect a step it already
+// applied (current == To) or one it cannot apply (current != From).
+type migrationStep struct {
+	DBName    string `json:"dbname"`
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Direction string `json:"direction"`
+	SQL       string `json:"sql"`
+	From      int    `json:"from"`
+	To        int    `json:"to"`
+}
+
+// schemaVersion returns the applied version of dbname, 0 if none.
+func schemaVersion(ctx context.Context, dbname string) (int, error) {
+	var version int
+	err := dbQueryRow(ctx, "SELECT version FROM `"+clusterSchema+"`.`schema_versions` WHERE dbname = ?", dbname).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+// schemaVersions returns the applied version of every migrated database.
+func schemaVersions(ctx context.Context) (map[string]int, error) {
+	rows, err := dbQuery(ctx, "SELECT dbname, version FROM `"+clusterSchema+"`.`schema_versions`")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := map[string]int{}
+	for rows.Next() {
+		var dbname string
+		var version int
+		if err := rows.Scan(&dbname, &version); err != nil {
+			return nil, err
+		}
+		if version != 0 {
+			versions[dbname] = version
+		}
+	}
+	return versions, rows.Err()
+}
+
+// loadMigrations returns the registered migrations of dbname by version.
+func loadMigrations(ctx context.Context, dbname string) ([]migration, error) {
+	rows, err := dbQuery(ctx, "SELECT version, name, up_sql, down_sql FROM `"+clusterSchema+"`.`migrations` WHERE dbname = ? ORDER BY version", dbname)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var migrations []migration
+	for rows.Next() {
+		m := migration{DBName: dbname}
+		if err := rows.Scan(&m.Version, &m.Name, &m.Up, &m.Down); err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, m)
+	}
+	return migrations, rows.Err()
+}
+
+func saveMigration(ctx context.Context, m migration) error {
+	_, err := dbExec(ctx, "INSERT INTO `"+clusterSchema+"`.`migrations` (dbname, version, name, up_sql, down_sql) VALUES (?, ?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE name = VALUES(name), up_sql = VALUES(up_sql), down_sql = VALUES(down_sql)",
+		m.DBName, m.Version, m.Name, m.Up, m.Down)
+	return err
+}
+
+// applyStep runs the SQL of step against its database and records the new
+// version. DDL commits implicitly in MySQL, so a failing script can leave
+// its earlier statements applied; the version is only advanced on success.
+func applyStep(ctx context.Context, step migrationStep) error {
+	ctx, span := tracer.Start(ctx, "migration "+step.Direction)
+	statements, err := splitStatements(step.SQL)
+	if err != nil {
+		endSpan(span, err)
+		return err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		endSpan(span, err)
+		return err
+	}
+	defer conn.Close()
+	// The connection's default database is changed below; discard it
+	// afterwards instead of returning it to the pool.
+	defer conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	// Scripts may touch any table, and may fail halfway.
+	defer resultCache.purge()
+
+	name, _ := quoteIdent(step.DBName)
+	if _, err := conn.ExecContext(ctx, tagQuery(ctx, "USE "+name)); err != nil {
+		endSpan(span, err)
+		return err
+	}
+	for i, stmt := range statements {
+		if _, err := conn.ExecContext(ctx, tagQuery(ctx, stmt)); err != nil {
+			err = fmt.Errorf("statement %d: %w", i+1, err)
+			endSpan(span, err)
+			return err
+		}
+	}
+
+	_, err = conn.ExecContext(ctx, tagQuery(ctx, "INSERT INTO `"+clusterSchema+"`.`schema_versions` (dbname, version) VALUES (?, ?) "+
+		"ON DUPLICATE KEY UPDATE version = VALUES(version)"), step.DBName, step.To)
+	endSpan(span, err)
+	return err
+}
+
+// planSteps returns the steps that take dbname from current to target.
+func planSteps(migrations []migration, current, target int) ([]migrationStep, error) {
+	var steps []migrationStep
+	if target >= current {
+		from := current
+		for _, m := range migrations {
+			if m.Version > current && m.Version <= target {
+				steps = append(steps, migrationStep{DBName: m.DBName, Version: m.Version, Name: m.Name,
+					Direction: "up", SQL: m.Up, From: from, To: m.Version})
+				from = m.Version
+			}
+		}
+		return steps, nil
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version > current || m.Version <= target {
+			continue
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %d (%s) has no down script", m.Version, m.Name)
+		}
+		to := 0
+		if i > 0 {
+			to = migrations[i-1].Version
+		}
+		steps = append(steps, migrationStep{DBName: m.DBName, Version: m.Version, Name: m.Name,
+			Direction: "down", SQL: m.Down, From: m.Version, To: to})
+	}
+	return steps, nil
+}
+
+// migrateRequest is the body of /migrate and /rollback. Target defaults to
+// the latest migration for /migrate and to the previous one for /rollback.
+type migrateRequest struct {
+	DBName string `json:"dbname"`
+	Target *int   `json:"target,omitempty"`
+}
+
+// runMigrations moves a database to a target version on the master,
+// replicating every step as soon as it is applied.
+func runMigrations(w http.ResponseWriter, r *http.Request, rollback bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req migrateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.DBName == "" {
+		http.Error(w, "dbname is required", http.StatusBadRequest)
+		return
+	}
+
+	migrateMu.Lock()
+	defer migrateMu.Unlock()
+
+	// Once started, the steps run to the end even if the client goes away,
+	// so the schema and its recorded version stay in step.
+	ctx := detachWrite(r.Context())
+	current, err := schemaVersion(ctx, req.DBName)
+	if err != nil {
+		http.Error(w, "Failed to read schema version: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	migrations, err := loadMigrations(ctx, req.DBName)
+	if err != nil {
+		http.Error(w, "Failed to load migrations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var target int
+	switch {
+	case req.Target != nil:
+		target = *req.Target
+	case rollback:
+		for _, m := range migrations {
+			if m.Version < current {
+				target = m.Version
+			}
+		}
+	case len(migrations) > 0:
+		target = migrations[len(migrations)-1].Version
+	}
+	if target < 0 || (rollback && target > current) || (!rollback && target < current) {
+		http.Error(w, fmt.Sprintf("Invalid target %d for current version %d", target, current), http.StatusBadRequest)
+		return
+	}
+
+	steps, err := planSteps(migrations, current, target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	applied := []int{}
+	for _, step := range steps {
+		if err := applyStep(ctx, step); err != nil {
+			loggerFrom(ctx).Error("Migration failed", "dbname", step.DBName, "version", step.Version,
+				"direction", step.Direction, "error", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message": fmt.Sprintf("Migration %d (%s) failed: %v", step.Version, step.Name, err),
+				"dbname":  req.DBName,
+				"version": step.From,
+				"applied": applied,
+			})
+			return
+		}
+		replicateToSlavesJSON(ctx, "/replicate/migrate", step)
+		applied = append(applied, step.Version)
+		current = step.To
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Database %s is at version %d", req.DBName, current),
+		"dbname":  req.DBName,
+		"version": current,
+		"applied": applied,
+	})
+}
+
+func migrate(w http.ResponseWriter, r *http.Request) {
+	runMigrations(w, r, false)
+}
+
+func rollbackMigrations(w http.ResponseWriter, r *http.Request) {
+	runMigrations(w, r, true)
+}
+
+// manageMigrations lists the migrations of a database on GET and registers a
+// new one on POST. New migrations must be numbered above every registered one.
+func manageMigrations(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		listMigrations(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var m migration
+	if err := decodeJSON(r, &m); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := m.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	migrateMu.Lock()
+	defer migrateMu.Unlock()
+
+	existing, err := loadMigrations(r.Context(), m.DBName)
+	if err != nil {
+		http.Error(w, "Failed to load migrations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n := len(existing); n > 0 && existing[n-1].Version >= m.Version {
+		http.Error(w, fmt.Sprintf("Version must be greater than %d", existing[n-1].Version), http.StatusConflict)
+		return
+	}
+	if err := saveMigration(detachWrite(r.Context()), m); err != nil {
+		http.Error(w, "Failed to register migration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	replicateToSlavesJSON(r.Context(), "/replicate/migrations", m)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Migration registered successfully"})
+}
+
+func listMigrations(w http.ResponseWriter, r *http.Request) {
+	dbname := r.URL.Query().Get("dbname")
+	if dbname == "" {
+		http.Error(w, "dbname parameter is required", http.StatusBadRequest)
+		return
+	}
+	current, err := schemaVersion(r.Context(), dbname)
+	if err != nil {
+		http.Error(w, "Failed to read schema version: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	registered, err := loadMigrations(r.Context(), dbname)
+	if err != nil {
+		http.Error(w, "Failed to load migrations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type migrationStatus struct {
+		migration
+		Applied bool `json:"applied"`
+	}
+	list := make([]migrationStatus, len(registered))
+	for i, m := range registered {
+		list[i] = migrationStatus{migration: m, Applied: m.Version <= current}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dbname":     dbname,
+		"version":    current,
+		"migrations": list,
+	})
+}
+
+// listSchemaVersions reports this node's applied version per database. Nodes
+// compare against the leader's list at startup.
+func listSchemaVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := schemaVersions(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to read schema versions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"versions": versions})
+}
+
+func replicateMigrations(w http.ResponseWriter, r *http.Request) {
+	var m migration
+	if err := decodeJSON(r, &m); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := m.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := saveMigration(r.Context(), m); err != nil {
+		http.Error(w, "Failed to register migration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Migration registered successfully"})
+}
+
+func replicateMigrate(w http.ResponseWriter, r *http.Request) {
+	var step migrationStep
+	if err := decodeJSON(r, &step); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if _, err := quoteIdent(step.DBName); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	migrateMu.Lock()
+	defer migrateMu.Unlock()
+
+	current, err := schemaVersion(r.Context(), step.DBName)
+	if err != nil {
+		http.Error(w, "Failed to read schema version: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	switch current {
+	case step.To:
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Migration already applied"})
+		return
+	case step.From:
+	default:
+		http.Error(w, fmt.Sprintf("Schema version mismatch: at %d, migration %d %s expects %d",
+			current, step.Version, step.Direction, step.From), http.StatusConflict)
+		return
+	}
+
+	if err := applyStep(r.Context(), step); err != nil {
+		http.Error(w, "Failed to apply migration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Migration applied successfully"})
+}
+
+// checkSchemaVersions compares this node's schema versions with the
+// leader's. It wraps errSchemaMismatch when they differ; other errors mean
+// the leader could not be asked.
+func checkSchemaVersions(ctx context.Context, leader string) error {
+	local, err := schemaVersions(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, leader+"/schema-versions", nil)
+	if err != nil {
+		return err
+	}
+	authorize(req)
+	resp, err := replicationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("leader returned %s", resp.Status)
+	}
+	var remote struct {
+		Versions map[string]int `json:"versions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&remote); err != nil {
+		return err
+	}
+
+	var diffs []string
+	for dbname, version := range remote.Versions {
+		if local[dbname] != version {
+			diffs = append(diffs, fmt.Sprintf("%s: local %d, leader %d", dbname, local[dbname], version))
+		}
+	}
+	for dbname, version := range local {
+		if _, ok := remote.Versions[dbname]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: local %d, leader 0", dbname, version))
+		}
+	}
+	if len(diffs) > 0 {
+		sort.Strings(diffs)
+		return fmt.Errorf("%w (%s)", errSchemaMismatch, strings.Join(diffs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// orderBy is one ORDER BY term of a select.
+type orderBy struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc,omitempty"`
+}
+
+// selectRequest describes a /select query. It is read from a JSON body on
+// POST and from URL parameters on GET:
+//
+//	dbname, table  required
+//	columns        comma-separated columns to return (default all)
+//	where          filter as JSON
+//	order          comma-separated columns, "-" prefix for descending
+//	limit, offset  pagination
+//	count          "true" to report the number of matching rows
+//	stream         "ndjson" or "json" to stream rows as they are read
+//	keyset         "true" to page by sort key; the response carries a
+//	               nextCursor while more rows follow
+//	cursor         a nextCursor from the previous page (implies keyset)
+type selectRequest struct {
+	DBName  string    `json:"dbname"`
+	Table   string    `json:"table"`
+	Columns []string  `json:"columns,omitempty"`
+	Where   *filter   `json:"where,omitempty"`
+	OrderBy []orderBy `json:"orderBy,omitempty"`
+	Limit   int       `json:"limit,omitempty"`
+	Offset  int       `json:"offset,omitempty"`
+	Count   bool      `json:"count,omitempty"`
+	Stream  string    `json:"stream,omitempty"`
+	Keyset  bool      `json:"keyset,omitempty"`
+	Cursor  string    `json:"cursor,omitempty"`
+}
+
+// parseSelectRequest reads a selectRequest from r.
+func parseSelectRequest(r *http.Request) (selectRequest, error) {
+	var req selectRequest
+	if r.Method == http.MethodPost {
+		if err := decodeJSON(r, &req); err != nil {
+			return req, errors.New("Invalid request body")
+		}
+		return req, req.validateStream()
+	}
+
+	q := r.URL.Query()
+	req.DBName = q.Get("dbname")
+	req.Table = q.Get("table")
+	if columns := q.Get("columns"); columns != "" {
+		for _, col := range strings.Split(columns, ",") {
+			req.Columns = append(req.Columns, strings.TrimSpace(col))
+		}
+	}
+	if where := q.Get("where"); where != "" {
+		dec := json.NewDecoder(strings.NewReader(where))
+		dec.UseNumber()
+		if err := dec.Decode(&req.Where); err != nil {
+			return req, fmt.Errorf("invalid where: %v", err)
+		}
+	}
+	if order := q.Get("order"); order != "" {
+		for _, term := range strings.Split(order, ",") {
+			term = strings.TrimSpace(term)
+			desc := strings.HasPrefix(term, "-")
+			req.OrderBy = append(req.OrderBy, orderBy{Column: strings.TrimPrefix(term, "-"), Desc: desc})
+		}
+	}
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if req.Limit, err = strconv.Atoi(v); err != nil {
+			return req, fmt.Errorf("invalid limit %q", v)
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if req.Offset, err = strconv.Atoi(v); err != nil {
+			return req, fmt.Errorf("invalid offset %q", v)
+		}
+	}
+	if v := q.Get("count"); v != "" {
+		if req.Count, err = strconv.ParseBool(v); err != nil {
+			return req, fmt.Errorf("invalid count %q", v)
+		}
+	}
+	if v := q.Get("keyset"); v != "" {
+		if req.Keyset, err = strconv.ParseBool(v); err != nil {
+			return req, fmt.Errorf("invalid keyset %q", v)
+		}
+	}
+	req.Cursor = q.Get("cursor")
+	req.Stream = q.Get("stream")
+	return req, req.validateStream()
+}
+
+func (req selectRequest) validateStream() error {
+	switch req.Stream {
+	case "", "ndjson", "json":
+		return nil
+	}
+	return fmt.Errorf("invalid stream %q (expected ndjson or json)", req.Stream)
+}
+
+// fromWhere renders "FROM `db`.`table` [WHERE ...]" for req.
+func (req selectRequest) fromWhere() (string, []interface{}, error) {
+	if req.DBName == "" || req.Table == "" {
+		return "", nil, errors.New("Both dbname and table parameters are required")
+	}
+	table, err := qualifiedTable(req.DBName, req.Table)
+	if err != nil {
+		return "", nil, err
+	}
+	clause := "FROM " + table
+	if req.Where == nil {
+		return clause, nil, nil
+	}
+	where, args, err := req.Where.build()
+	if err != nil {
+		return "", nil, err
+	}
+	return clause + " WHERE " + where, args, nil
+}
+
+// orderClause renders " ORDER BY ..." for terms, or "" if there are none.
+func orderClause(terms []orderBy) (string, error) {
+	if len(terms) == 0 {
+		return "", nil
+	}
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		col, err := quoteIdent(term.Column)
+		if err != nil {
+			return "", err
+		}
+		if term.Desc {
+			col += " DESC"
+		}
+		parts = append(parts, col)
+	}
+	return " ORDER BY " + strings.Join(parts, ", "), nil
+}
+
+// limitClause renders " LIMIT ... OFFSET ..." or "" when neither is set.
+func limitClause(limit, offset int) (string, error) {
+	if limit < 0 || offset < 0 {
+		return "", errors.New("limit and offset must not be negative")
+	}
+	switch {
+	case limit > 0 && offset > 0:
+		return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset), nil
+	case limit > 0:
+		return fmt.Sprintf(" LIMIT %d", limit), nil
+	case offset > 0:
+		// MySQL has no OFFSET without LIMIT; use the documented maximum.
+		return fmt.Sprintf(" LIMIT 18446744073709551615 OFFSET %d", offset), nil
+	}
+	return "", nil
+}
+
+// projection renders the select list for req: the requested columns, or *.
+func (req selectRequest) projection() (string, error) {
+	if len(req.Columns) == 0 {
+		return "*", nil
+	}
+	cols := make([]string, 0, len(req.Columns))
+	for _, name := range req.Columns {
+		col, err := quoteIdent(name)
+		if err != nil {
+			return "", err
+		}
+		cols = append(cols, col)
+	}
+	return strings.Join(cols, ", "), nil
+}
+
+// buildSelect renders the SELECT statement for req.
+func buildSelect(req selectRequest) (string, []interface{}, error) {
+	from, args, err := req.fromWhere()
+	if err != nil {
+		return "", nil, err
+	}
+	cols, err := req.projection()
+	if err != nil {
+		return "", nil, err
+	}
+	order, err := orderClause(req.OrderBy)
+	if err != nil {
+		return "", nil, err
+	}
+	limit, err := limitClause(req.Limit, req.Offset)
+	if err != nil {
+		return "", nil, err
+	}
+	return "SELECT " + cols + " " + from + order + limit, args, nil
+}
+
+// buildCount renders the statement counting every row matched by req,
+// ignoring its ordering and pagination.
+func buildCount(req selectRequest) (string, []interface{}, error) {
+	from, args, err := req.fromWhere()
+	if err != nil {
+		return "", nil, err
+	}
+	return "SELECT COUNT(*) " + from, args, nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// minReplicationTimeout bounds a replication attempt of a request that had a
+// shorter deadline, or none.
+const minReplicationTimeout = 5 * time.Second
+
+// replicationTask is one write that still has to reach one slave. Tasks are
+// persisted to disk when the node shuts down before they complete. Timeout
+// bounds one attempt; it is at least the deadline the write had on the
+// master, so a slave gets as long to apply it.
+type replicationTask struct {
+	Slave     string        `json:"slave"`
+	Method    string        `json:"method"`
+	Path      string        `json:"path"`
+	Body      []byte        `json:"body,omitempty"`
+	RequestID string        `json:"requestId,omitempty"`
+	Timeout   time.Duration `json:"timeout,omitempty"`
+}
+
+func (t *replicationTask) timeout() time.Duration {
+	return max(t.Timeout, minReplicationTimeout)
+}
+
+var (
+	replicationWG sync.WaitGroup
+
+	pendingMu          sync.Mutex
+	pendingReplication = map[*replicationTask]struct{}{}
+
+	// replicationDelivered and replicationFailed count tasks that reached
+	// their slave and tasks that were dropped after exhausting their retries.
+	replicationDelivered atomic.Int64
+	replicationFailed    atomic.Int64
+
+	// stopReplication is closed when the drain deadline passes; retry loops
+	// then give up and leave their task in pendingReplication.
+	stopReplication = make(chan struct{})
+)
+
+// pendingReplicationFile is where unfinished replication work is written on
+// shutdown and read back on startup.
+func pendingReplicationFile() string {
+	if path := os.Getenv("PENDING_REPLICATION_FILE"); path != "" {
+		return path
+	}
+	return "pending_replication.json"
+}
+
+// replicateToSlaves sends a GET replication request to every slave. The
+// request ID in ctx is forwarded so the write can be followed across nodes;
+// ctx cancellation is ignored because replication outlives the request.
+func replicateToSlaves(ctx context.Context, path string) {
+	replicate(ctx, http.MethodGet, path, nil)
+}
+
+// replicateToSlavesJSON POSTs data as JSON to path on every slave.
+func replicateToSlavesJSON(ctx context.Context, path string, data interface{}) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		loggerFrom(ctx).Error("Failed to marshal data for replication", "path", path, "error", err)
+		return
+	}
+	replicate(ctx, http.MethodPost, path, jsonData)
+}
+
+func replicate(ctx context.Context, method, path string, body []byte) {
+	for _, addr := range currentSlaves() {
+		runReplicationTask(ctx, &replicationTask{
+			Slave:     addr,
+			Method:    method,
+			Path:      path,
+			Body:      body,
+			RequestID: requestIDFrom(ctx),
+			Timeout:   requestTimeoutFrom(ctx),
+		})
+	}
+}
+
+// runReplicationTask delivers task in the background, retrying with
+// exponential backoff. The task stays in pendingReplication until it either
+// succeeds or exhausts its retries.
+func runReplicationTask(ctx context.Context, task *replicationTask) {
+	ctx = context.WithoutCancel(ctx)
+	if requestIDFrom(ctx) == "" && task.RequestID != "" {
+		ctx = context.WithValue(ctx, requestIDKey{}, task.RequestID)
+	}
+	logger := loggerFrom(ctx)
+
+	pendingMu.Lock()
+	pendingReplication[task] = struct{}{}
+	pendingMu.Unlock()
+
+	replicationWG.Add(1)
+	go func() {
+		defer replicationWG.Done()
+
+		maxRetries := 3
+		retryDelay := 2 * time.Second
+
+		for i := 0; i < maxRetries; i++ {
+			err := replicateOnce(ctx, task, i+1)
+			if err == nil {
+				logger.Info("Replication succeeded", "slave", task.Slave, "path", task.Path, "attempt", i+1)
+				replicationDelivered.Add(1)
+				finishReplicationTask(task)
+				return
+			}
+
+			if i < maxRetries-1 {
+				logger.Warn("Replication attempt failed, retrying",
+					"slave", task.Slave, "path", task.Path, "attempt", i+1, "retry_in", retryDelay.String(), "error", err)
+				select {
+				case <-time.After(retryDelay):
+				case <-stopReplication:
+					logger.Warn("Replication interrupted by shutdown", "slave", task.Slave, "path", task.Path)
+					return
+				}
+				retryDelay *= 2
+			} else {
+				logger.Error("Replication failed", "slave", task.Slave, "path", task.Path, "attempts", maxRetries, "error", err)
+				replicationFailed.Add(1)
+			}
+		}
+		finishReplicationTask(task)
+	}()
+}
+
+func finishReplicationTask(task *replicationTask) {
+	pendingMu.Lock()
+	delete(pendingReplication, task)
+	pendingMu.Unlock()
+}
+
+// replicateOnce performs a single replication attempt inside its own span.
+func replicateOnce(ctx context.Context, task *replicationTask, attempt int) error {
+	ctx, span := tracer.Start(ctx, "replicate "+task.Path, trace.WithAttributes(
+		attribute.String("replication.slave", task.Slave),
+		attribute.Int("replication.attempt", attempt),
+	))
+	ctx, cancel := context.WithTimeout(ctx, task.timeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, task.Method, task.Slave+task.Path, bytes.NewReader(task.Body))
+	if err != nil {
+		endSpan(span, err)
+		return err
+	}
+	if task.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if id := requestIDFrom(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+	authorize(req)
+
+	resp, err := replicationClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("unexpected status %s", resp.Status)
+		}
+	}
+	endSpan(span, err)
+	return err
+}
+
+// pendingReplicationCount returns the number of replication tasks in flight.
+func pendingReplicationCount() int {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	return len(pendingReplication)
+}
+
+// drainReplication waits up to timeout for in-flight replication to finish
+// and returns the tasks still pending afterwards.
+func drainReplication(timeout time.Duration) []*replicationTask {
+	done := make(chan struct{})
+	go func() {
+		replicationWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+	}
+
+	// Interrupt the retry back-off and wait for attempts already on the wire,
+	// which are bounded by their own request timeout.
+	close(stopReplication)
+	<-done
+
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	tasks := make([]*replicationTask, 0, len(pendingReplication))
+	for task := range pendingReplication {
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// persistReplication writes tasks to the pending file so the next start of
+// this node can resume them.
+func persistReplication(tasks []*replicationTask) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(tasks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(pendingReplicationFile(), data, 0o600)
+}
+
+// resumePendingReplication restarts replication tasks persisted by a previous
+// shutdown and removes the file.
+func resumePendingReplication() {
+	path := pendingReplicationFile()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to read pending replication", "file", path, "error", err)
+		return
+	}
+
+	var tasks []*replicationTask
+	if err := json.Unmarshal(data, &tasks); err != nil {
+		slog.Error("Failed to parse pending replication", "file", path, "error", err)
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		slog.Error("Failed to remove pending replication file", "file", path, "error", err)
+		return
+	}
+
+	slog.Info("Resuming pending replication", "tasks", len(tasks))
+	for _, task := range tasks {
+		runReplicationTask(context.Background(), task)
+	}
+}
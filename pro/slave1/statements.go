@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// identifierPattern matches the database, table and column names accepted by
+// the structured endpoints. Anything else is rejected rather than escaped.
+var identifierPattern = regexp.MustCompile(`^[A-Za-z0-9_$]{1,64}$`)
+
+// quoteIdent validates name and returns it quoted with backticks.
+func quoteIdent(name string) (string, error) {
+	if !identifierPattern.MatchString(name) {
+		return "", fmt.Errorf("invalid identifier %q", name)
+	}
+	return "`" + name + "`", nil
+}
+
+// qualifiedTable returns the quoted `db`.`table` reference.
+func qualifiedTable(dbname, table string) (string, error) {
+	qdb, err := quoteIdent(dbname)
+	if err != nil {
+		return "", err
+	}
+	qtable, err := quoteIdent(table)
+	if err != nil {
+		return "", err
+	}
+	return qdb + "." + qtable, nil
+}
+
+// errClusterSchema rejects writes to the cluster's metadata schema, which
+// only the endpoints that manage migrations and named queries may change.
+var errClusterSchema = fmt.Errorf("The %s schema is managed by the cluster and cannot be written", clusterSchema)
+
+// writableSchema validates dbname as the target of a write.
+func writableSchema(dbname string) error {
+	if strings.EqualFold(dbname, clusterSchema) {
+		return errClusterSchema
+	}
+	_, err := quoteIdent(dbname)
+	return err
+}
+
+// writableTable is qualifiedTable for a table that is written to.
+func writableTable(dbname, table string) (string, error) {
+	if err := writableSchema(dbname); err != nil {
+		return "", err
+	}
+	return qualifiedTable(dbname, table)
+}
+
+// decodeJSON decodes the request body into v, keeping numbers as json.Number
+// so large integers and decimals reach MySQL unchanged.
+func decodeJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// sqlValue converts a decoded JSON value into a statement argument. Objects
+// and arrays are stored as their JSON text, e.g. for JSON columns.
+func sqlValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	case json.Number:
+		return v.String(), nil
+	default:
+		return v, nil
+	}
+}
+
+// filter is a structured WHERE expression. A node is either a comparison
+//
+//	{"column": "id", "op": "eq", "value": 1}
+//	{"column": "id", "op": "in", "value": [1, 2, 3]}
+//	{"column": "name", "op": "like", "value": "A%"}
+//	{"column": "email", "op": "isnull"}
+//
+// or a combination of child filters
+//
+//	{"and": [...]} / {"or": [...]} / {"not": {...}}
+type filter struct {
+	Column string      `json:"column,omitempty"`
+	Op     string      `json:"op,omitempty"`
+	Value  interface{} `json:"value"`
+	And    []filter    `json:"and,omitempty"`
+	Or     []filter    `json:"or,omitempty"`
+	Not    *filter     `json:"not,omitempty"`
+}
+
+// comparisonOps maps filter operators to SQL.
+var comparisonOps = map[string]string{
+	"eq":   "=",
+	"ne":   "<>",
+	"lt":   "<",
+	"lte":  "<=",
+	"gt":   ">",
+	"gte":  ">=",
+	"like": "LIKE",
+}
+
+// build renders f as a parameterized SQL condition.
+func (f filter) build() (string, []interface{}, error) {
+	switch {
+	case f.And != nil:
+		return buildJunction("AND", f.And)
+	case f.Or != nil:
+		return buildJunction("OR", f.Or)
+	case f.Not != nil:
+		cond, args, err := f.Not.build()
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + cond + ")", args, nil
+	}
+
+	col, err := quoteIdent(f.Column)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch f.Op {
+	case "isnull":
+		return col + " IS NULL", nil, nil
+	case "notnull":
+		return col + " IS NOT NULL", nil, nil
+	case "in", "nin":
+		list, ok := f.Value.([]interface{})
+		if !ok || len(list) == 0 {
+			return "", nil, fmt.Errorf("filter on %s: %s needs a non-empty array value", f.Column, f.Op)
+		}
+		args := make([]interface{}, 0, len(list))
+		for _, item := range list {
+			val, err := sqlValue(item)
+			if err != nil {
+				return "", nil, err
+			}
+			args = append(args, val)
+		}
+		keyword := " IN ("
+		if f.Op == "nin" {
+			keyword = " NOT IN ("
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+		return col + keyword + placeholders + ")", args, nil
+	}
+
+	op, ok := comparisonOps[f.Op]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown filter operator %q", f.Op)
+	}
+	if f.Value == nil {
+		return "", nil, fmt.Errorf("filter on %s: value is required", f.Column)
+	}
+	val, err := sqlValue(f.Value)
+	if err != nil {
+		return "", nil, err
+	}
+	return col + " " + op + " ?", []interface{}{val}, nil
+}
+
+func buildJunction(joiner string, children []filter) (string, []interface{}, error) {
+	if len(children) == 0 {
+		return "", nil, fmt.Errorf("empty %s filter", strings.ToLower(joiner))
+	}
+	parts := make([]string, 0, len(children))
+	var args []interface{}
+	for _, child := range children {
+		cond, childArgs, err := child.build()
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, "("+cond+")")
+		args = append(args, childArgs...)
+	}
+	return strings.Join(parts, " "+joiner+" "), args, nil
+}
+
+// assignments validates and quotes the columns of a column→value map and
+// returns them with their arguments, sorted by column so the same request
+// always yields the same SQL on every node. The row version may not be
+// written.
+func assignments(values map[string]interface{}) ([]string, []interface{}, error) {
+	cols := make([]string, 0, len(values))
+	for col := range values {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+
+	quoted := make([]string, 0, len(cols))
+	args := make([]interface{}, 0, len(cols))
+	for _, col := range cols {
+		if strings.EqualFold(col, versionColumn) {
+			return nil, nil, errVersionColumn
+		}
+		qcol, err := quoteIdent(col)
+		if err != nil {
+			return nil, nil, err
+		}
+		val, err := sqlValue(values[col])
+		if err != nil {
+			return nil, nil, err
+		}
+		quoted = append(quoted, qcol)
+		args = append(args, val)
+	}
+	return quoted, args, nil
+}
+
+// insertRequest is the body of /insert and /replicate/insert.
+type insertRequest struct {
+	DBName string                 `json:"dbname"`
+	Table  string                 `json:"table"`
+	Values map[string]interface{} `json:"values"`
+}
+
+func buildInsert(req insertRequest) (string, []interface{}, error) {
+	if req.DBName == "" || req.Table == "" || len(req.Values) == 0 {
+		return "", nil, errors.New("All fields (dbname, table, values) are required")
+	}
+	table, err := writableTable(req.DBName, req.Table)
+	if err != nil {
+		return "", nil, err
+	}
+	cols, args, err := assignments(req.Values)
+	if err != nil {
+		return "", nil, err
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(cols, ", "), placeholders)
+	return query, args, nil
+}
+
+// updateRequest is the body of /update and /replicate/update.
+type updateRequest struct {
+	DBName string                 `json:"dbname"`
+	Table  string                 `json:"table"`
+	Set    map[string]interface{} `json:"set"`
+	Where  *filter                `json:"where"`
+	// ExpectedVersion makes the update conditional on the row's version;
+	// see updateIfVersion. It is never replicated.
+	ExpectedVersion *uint64 `json:"expectedVersion,omitempty"`
+}
+
+func buildUpdate(req updateRequest) (string, []interface{}, error) {
+	if req.DBName == "" || req.Table == "" || len(req.Set) == 0 || req.Where == nil {
+		return "", nil, errors.New("All fields (dbname, table, set, where) are required")
+	}
+	table, err := writableTable(req.DBName, req.Table)
+	if err != nil {
+		return "", nil, err
+	}
+	cols, args, err := assignments(req.Set)
+	if err != nil {
+		return "", nil, err
+	}
+	where, whereArgs, err := req.Where.build()
+	if err != nil {
+		return "", nil, err
+	}
+	for i := range cols {
+		cols[i] += " = ?"
+	}
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", table, strings.Join(cols, ", "), where)
+	return query, append(args, whereArgs...), nil
+}
+
+// deleteRequest is the body of /delete and /replicate/delete.
+type deleteRequest struct {
+	DBName string  `json:"dbname"`
+	Table  string  `json:"table"`
+	Where  *filter `json:"where"`
+}
+
+func buildDelete(req deleteRequest) (string, []interface{}, error) {
+	if req.DBName == "" || req.Table == "" || req.Where == nil {
+		return "", nil, errors.New("All fields (dbname, table, where) are required")
+	}
+	table, err := writableTable(req.DBName, req.Table)
+	if err != nil {
+		return "", nil, err
+	}
+	where, args, err := req.Where.build()
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", table, where), args, nil
+}
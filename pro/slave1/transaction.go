@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultTransactionTimeout = 10 * time.Second
+	maxTransactionTimeout     = 60 * time.Second
+)
+
+// operation is one write in a /transaction batch. Op selects which of the
+// remaining fields apply, mirroring the bodies of /insert, /update, /delete
+// and /upsert. ExpectRows, when set, aborts the batch unless the operation
+// affects exactly that many rows, e.g. a debit guarded by "balance >= amount"
+// that must hit its row.
+type operation struct {
+	Op           string                 `json:"op"`
+	DBName       string                 `json:"dbname"`
+	Table        string                 `json:"table"`
+	Values       map[string]interface{} `json:"values,omitempty"`
+	Set          map[string]interface{} `json:"set,omitempty"`
+	Where        *filter                `json:"where,omitempty"`
+	ConflictKeys []string               `json:"conflictKeys,omitempty"`
+	Update       []string               `json:"update,omitempty"`
+	ExpectRows   *int64                 `json:"expectRows,omitempty"`
+}
+
+func (op operation) build() (string, []interface{}, error) {
+	switch op.Op {
+	case "insert":
+		return buildInsert(insertRequest{DBName: op.DBName, Table: op.Table, Values: op.Values})
+	case "update":
+		return buildUpdate(updateRequest{DBName: op.DBName, Table: op.Table, Set: op.Set, Where: op.Where})
+	case "delete":
+		return buildDelete(deleteRequest{DBName: op.DBName, Table: op.Table, Where: op.Where})
+	case "upsert":
+		return buildUpsert(upsertRequest{DBName: op.DBName, Table: op.Table, Values: op.Values,
+			ConflictKeys: op.ConflictKeys, Update: op.Update})
+	}
+	return "", nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// transactionRequest is the body of /transaction and /replicate/transaction.
+// TimeoutMs bounds the whole batch, including waiting for row locks. ID is
+// set by the master when it replicates the batch and, like a bulk chunk ID,
+// makes a slave apply the batch only once however often it is retried.
+type transactionRequest struct {
+	Operations []operation `json:"operations"`
+	TimeoutMs  int         `json:"timeoutMs,omitempty"`
+	ID         string      `json:"id,omitempty"`
+}
+
+func (req transactionRequest) timeout() (time.Duration, error) {
+	if req.TimeoutMs < 0 {
+		return 0, errors.New("timeoutMs must not be negative")
+	}
+	if req.TimeoutMs == 0 {
+		return defaultTransactionTimeout, nil
+	}
+	timeout := time.Duration(req.TimeoutMs) * time.Millisecond
+	if timeout > maxTransactionTimeout {
+		return 0, fmt.Errorf("timeoutMs must be at most %d", maxTransactionTimeout.Milliseconds())
+	}
+	return timeout, nil
+}
+
+// replicated returns the batch as the slaves apply it. The master already
+// enforced ExpectRows and the timeout; a slave, whose state may lag or differ,
+// must apply what the master committed rather than check them again.
+func (req transactionRequest) replicated() transactionRequest {
+	ops := make([]operation, len(req.Operations))
+	for i, op := range req.Operations {
+		op.ExpectRows = nil
+		ops[i] = op
+	}
+	return transactionRequest{Operations: ops, ID: req.ID}
+}
+
+// operationError reports which operation aborted a transaction and the HTTP
+// status that describes the failure.
+type operationError struct {
+	Index  int
+	Status int
+	Err    error
+}
+
+func (e *operationError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index+1, e.Err)
+}
+
+// runTransaction executes ops in one MySQL transaction and returns the rows
+// affected by each. Any failure rolls back the whole batch. A non-empty id is
+// recorded with the batch; see recordChunk.
+func runTransaction(ctx context.Context, id string, ops []operation) ([]int64, error) {
+	queries := make([]string, len(ops))
+	args := make([][]interface{}, len(ops))
+	for i, op := range ops {
+		var err error
+		if queries[i], args[i], err = op.build(); err != nil {
+			return nil, &operationError{Index: i, Status: http.StatusBadRequest, Err: err}
+		}
+	}
+
+	ctx, span := tracer.Start(ctx, "transaction")
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		endSpan(span, err)
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if id != "" {
+		if err := recordChunk(ctx, tx, id); err != nil {
+			endSpan(span, err)
+			return nil, err
+		}
+	}
+	affected := make([]int64, len(ops))
+	for i, op := range ops {
+		result, err := tx.ExecContext(ctx, tagQuery(ctx, queries[i]), args[i]...)
+		if err != nil {
+			endSpan(span, err)
+			return nil, &operationError{Index: i, Status: http.StatusInternalServerError, Err: err}
+		}
+		affected[i], _ = result.RowsAffected()
+		if op.ExpectRows != nil && affected[i] != *op.ExpectRows {
+			err := fmt.Errorf("expected %d affected rows, got %d", *op.ExpectRows, affected[i])
+			endSpan(span, err)
+			return nil, &operationError{Index: i, Status: http.StatusConflict, Err: err}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		endSpan(span, err)
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	for _, op := range ops {
+		resultCache.invalidate(op.DBName, op.Table)
+	}
+	endSpan(span, nil)
+	return affected, nil
+}
+
+// executeTransaction decodes a transactionRequest, runs it and writes the
+// response. It returns the request when the batch committed.
+func executeTransaction(w http.ResponseWriter, r *http.Request) (transactionRequest, bool) {
+	var req transactionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return req, false
+	}
+	if len(req.Operations) == 0 {
+		http.Error(w, "At least one operation is required", http.StatusBadRequest)
+		return req, false
+	}
+	timeout, err := req.timeout()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+
+	for i, op := range req.Operations {
+		if op.Op != "upsert" {
+			continue
+		}
+		upsert := upsertRequest{DBName: op.DBName, Table: op.Table, ConflictKeys: op.ConflictKeys}
+		if status, err := checkConflictKeys(r.Context(), upsert); err != nil {
+			http.Error(w, (&operationError{Index: i, Err: err}).Error(), status)
+			return req, false
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(detachWrite(r.Context()), timeout)
+	defer cancel()
+	affected, err := runTransaction(ctx, "", req.Operations)
+	if err != nil {
+		var opErr *operationError
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			http.Error(w, "Transaction rolled back: timed out", http.StatusGatewayTimeout)
+		case errors.As(err, &opErr):
+			http.Error(w, "Transaction rolled back: "+err.Error(), opErr.Status)
+		default:
+			http.Error(w, "Transaction rolled back: "+err.Error(), http.StatusInternalServerError)
+		}
+		return req, false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Transaction committed",
+		"rowsAffected": affected,
+	})
+	return req, true
+}
+
+// runTransactionBatch executes a batch of writes atomically and replicates the
+// committed batch to the slaves as a single unit.
+func runTransactionBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req, ok := executeTransaction(w, r); ok {
+		batch := req.replicated()
+		batch.ID = "tx-" + randomHex(8)
+		replicateToSlavesJSON(r.Context(), "/replicate/transaction", batch)
+	}
+}
+
+// replicateTransaction applies a batch committed on the master in one
+// transaction, so a replica never exposes half of it, and records its ID in
+// the same transaction, so a retry does not apply it twice. The batch is
+// applied without its guards and bounded only by the replication call.
+func replicateTransaction(w http.ResponseWriter, r *http.Request) {
+	var req transactionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Operations) == 0 {
+		http.Error(w, "At least one operation is required", http.StatusBadRequest)
+		return
+	}
+	affected, err := runTransaction(r.Context(), req.ID, req.replicated().Operations)
+	if errors.Is(err, errChunkApplied) {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":      "Transaction already applied",
+			"rowsAffected": []int64{},
+		})
+		return
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		var opErr *operationError
+		if errors.As(err, &opErr) {
+			status = opErr.Status
+		}
+		http.Error(w, "Transaction rolled back: "+err.Error(), status)
+		return
+	}
+	if req.ID != "" {
+		pruneAppliedChunks(r.Context())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Transaction committed",
+		"rowsAffected": affected,
+	})
+}
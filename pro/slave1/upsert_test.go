@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUniqueConflictKey(t *testing.T) {
+	primary := schemaIndex{Name: "PRIMARY", Unique: true, Columns: []string{"tenant", "id"}}
+	email := schemaIndex{Name: "email", Unique: true, Columns: []string{"email"}}
+	byName := schemaIndex{Name: "by_name", Columns: []string{"name"}}
+
+	tests := []struct {
+		indexes []schemaIndex
+		keys    []string
+		err     string
+	}{
+		{[]schemaIndex{primary, byName}, []string{"id", "tenant"}, ""},
+		{[]schemaIndex{primary}, []string{"TENANT", "Id"}, ""},
+		{[]schemaIndex{byName, email}, []string{"email"}, ""},
+		{[]schemaIndex{primary}, []string{"id"}, "columns of the PRIMARY key: tenant, id"},
+		{[]schemaIndex{primary}, []string{"tenant", "id", "name"}, "columns of the PRIMARY key"},
+		{[]schemaIndex{primary}, []string{"tenant", "tenant"}, "columns of the PRIMARY key"},
+		{[]schemaIndex{email}, []string{"name"}, "columns of the email key"},
+		{[]schemaIndex{primary, email}, []string{"tenant", "id"}, "exactly one primary or unique key; this table has 2 (PRIMARY, email)"},
+		{[]schemaIndex{byName}, []string{"name"}, "requires a table with a primary or unique key"},
+		{nil, []string{"id"}, "requires a table with a primary or unique key"},
+	}
+	for _, tt := range tests {
+		err := uniqueConflictKey(tt.indexes, tt.keys)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("uniqueConflictKey(%v, %q): %v", tt.indexes, tt.keys, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("uniqueConflictKey(%v, %q) error = %v, want it to contain %q", tt.indexes, tt.keys, err, tt.err)
+		}
+	}
+}
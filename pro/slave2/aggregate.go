@@ -0,0 +1,204 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// aggregateFuncs are the aggregate functions accepted by /aggregate.
+var aggregateFuncs = map[string]string{
+	"count": "COUNT",
+	"sum":   "SUM",
+	"avg":   "AVG",
+	"min":   "MIN",
+	"max":   "MAX",
+}
+
+// resultColumn is one entry of an /aggregate select list: a plain column or
+// an aggregate over a column, optionally renamed.
+//
+//	{"column": "country"}
+//	{"func": "count", "column": "*", "alias": "orders"}
+//	{"func": "sum", "column": "total", "distinct": true, "alias": "revenue"}
+type resultColumn struct {
+	Column   string `json:"column"`
+	Func     string `json:"func,omitempty"`
+	Distinct bool   `json:"distinct,omitempty"`
+	Alias    string `json:"alias,omitempty"`
+}
+
+func (c resultColumn) build() (string, error) {
+	var expr string
+	if c.Func == "" {
+		col, err := quoteIdent(c.Column)
+		if err != nil {
+			return "", err
+		}
+		expr = col
+	} else {
+		fn, ok := aggregateFuncs[c.Func]
+		if !ok {
+			return "", fmt.Errorf("unknown aggregate function %q", c.Func)
+		}
+		arg := "*"
+		if c.Column != "*" {
+			col, err := quoteIdent(c.Column)
+			if err != nil {
+				return "", err
+			}
+			arg = col
+		} else if fn != "COUNT" || c.Distinct {
+			return "", fmt.Errorf("%s(*) is not allowed", fn)
+		}
+		if c.Distinct {
+			arg = "DISTINCT " + arg
+		}
+		expr = fn + "(" + arg + ")"
+	}
+
+	if c.Alias != "" {
+		alias, err := quoteIdent(c.Alias)
+		if err != nil {
+			return "", err
+		}
+		expr += " AS " + alias
+	}
+	return expr, nil
+}
+
+// aggregateRequest is the body of /aggregate. Having is a filter whose
+// columns name result aliases, e.g. {"column": "orders", "op": "gt", "value": 5};
+// OrderBy may likewise refer to aliases.
+type aggregateRequest struct {
+	DBName  string         `json:"dbname"`
+	Table   string         `json:"table"`
+	Columns []resultColumn `json:"columns"`
+	Where   *filter        `json:"where,omitempty"`
+	GroupBy []string       `json:"groupBy,omitempty"`
+	Having  *filter        `json:"having,omitempty"`
+	OrderBy []orderBy      `json:"orderBy,omitempty"`
+	Limit   int            `json:"limit,omitempty"`
+	Offset  int            `json:"offset,omitempty"`
+}
+
+func buildAggregate(req aggregateRequest) (string, []interface{}, error) {
+	if len(req.Columns) == 0 {
+		return "", nil, errors.New("At least one column is required")
+	}
+	exprs := make([]string, 0, len(req.Columns))
+	for _, c := range req.Columns {
+		expr, err := c.build()
+		if err != nil {
+			return "", nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+
+	from, args, err := selectRequest{DBName: req.DBName, Table: req.Table, Where: req.Where}.fromWhere()
+	if err != nil {
+		return "", nil, err
+	}
+	query := "SELECT " + strings.Join(exprs, ", ") + " " + from
+
+	if len(req.GroupBy) > 0 {
+		cols := make([]string, 0, len(req.GroupBy))
+		for _, name := range req.GroupBy {
+			col, err := quoteIdent(name)
+			if err != nil {
+				return "", nil, err
+			}
+			cols = append(cols, col)
+		}
+		query += " GROUP BY " + strings.Join(cols, ", ")
+	}
+	if req.Having != nil {
+		having, havingArgs, err := req.Having.build()
+		if err != nil {
+			return "", nil, err
+		}
+		query += " HAVING " + having
+		args = append(args, havingArgs...)
+	}
+
+	order, err := orderClause(req.OrderBy)
+	if err != nil {
+		return "", nil, err
+	}
+	limit, err := limitClause(req.Limit, req.Offset)
+	if err != nil {
+		return "", nil, err
+	}
+	return query + order + limit, args, nil
+}
+
+// columnInfo describes one column of a result set. Nullable is omitted when
+// the driver cannot tell.
+type columnInfo struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable *bool  `json:"nullable,omitempty"`
+}
+
+// scanResult reads every row of rows together with the result's column
+// metadata. Values are decoded by column type (see decodeValue).
+func scanResult(rows *sql.Rows) ([]columnInfo, []map[string]interface{}, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to get columns: %v", err)
+	}
+	columns := resultColumns(types)
+
+	results := []map[string]interface{}{}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, nil, fmt.Errorf("Failed to scan row: %v", err)
+		}
+		results = append(results, decodeRow(columns, values))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("Error during rows iteration: %v", err)
+	}
+	return columns, results, nil
+}
+
+func aggregateRecords(w http.ResponseWriter, r *http.Request) {
+	var req aggregateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	query, args, err := buildAggregate(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := dbQuery(r.Context(), query, args...)
+	if err != nil {
+		http.Error(w, "Failed to query records: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	columns, results, err := scanResult(rows)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"columns": columns,
+		"rows":    results,
+	})
+}
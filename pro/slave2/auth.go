@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// adminToken, when set, guards every endpoint except publicPaths, so
+// untrusted clients can run vetted named queries but cannot read tables
+// directly, write or change the schema. Clients send it as
+// "Authorization: Bearer <token>". The nodes of a cluster share it and send
+// it with replication, leadership and schema calls. With no token configured
+// every client is treated as an admin.
+var adminToken = os.Getenv("ADMIN_TOKEN")
+
+// publicPaths are the endpoints any client may use: the health checks load
+// balancers probe, and /call, which runs only registered named queries.
+var publicPaths = map[string]bool{
+	"/livez":  true,
+	"/readyz": true,
+	"/call":   true,
+}
+
+// isAdmin reports whether r carries the admin token.
+func isAdmin(r *http.Request) bool {
+	if adminToken == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// withAdminToken rejects requests for anything but publicPaths with 401
+// unless they carry the admin token.
+func withAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] || r.Method == http.MethodOptions || requireAdmin(w, r) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// authorize adds the admin token, if any, to a call to another node.
+func authorize(req *http.Request) {
+	if adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+	}
+}
+
+// requireAdmin rejects r with 401 unless it carries the admin token.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if isAdmin(r) {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+	http.Error(w, "Admin token required", http.StatusUnauthorized)
+	return false
+}
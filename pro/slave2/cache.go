@@ -0,0 +1,347 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resultCache holds encoded /select responses on this node. It is bounded by
+// SELECT_CACHE_ENTRIES (default 1000, 0 disables it), SELECT_CACHE_BYTES
+// (default 64 MiB) and SELECT_CACHE_TTL (default 30s). Writes, replication
+// and DDL invalidate the tables they touch, which also drops the results of
+// tables whose foreign keys cascade from them.
+var resultCache = newSelectCache(
+	envInt("SELECT_CACHE_ENTRIES", 1000),
+	int64(envInt("SELECT_CACHE_BYTES", 64<<20)),
+	envDuration("SELECT_CACHE_TTL", 30*time.Second),
+)
+
+func envInt(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n >= 0 {
+		return n
+	}
+	return def
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// cachedHeaders are the response headers stored with a cached body.
+var cachedHeaders = []string{"X-Total-Count", "ETag"}
+
+// cacheEntry is one cached response. tables are the sources it was read
+// from; header holds its cachedHeaders.
+type cacheEntry struct {
+	key     string
+	tables  []string
+	body    []byte
+	header  http.Header
+	expires time.Time
+}
+
+// cacheStats is the response of GET /cache.
+type cacheStats struct {
+	Enabled       bool    `json:"enabled"`
+	Entries       int     `json:"entries"`
+	Bytes         int64   `json:"bytes"`
+	MaxEntries    int     `json:"maxEntries"`
+	MaxBytes      int64   `json:"maxBytes"`
+	TTL           string  `json:"ttl"`
+	Hits          int64   `json:"hits"`
+	Misses        int64   `json:"misses"`
+	HitRatio      float64 `json:"hitRatio"`
+	Evictions     int64   `json:"evictions"`
+	Expired       int64   `json:"expired"`
+	Invalidations int64   `json:"invalidations"`
+}
+
+// selectCache is an LRU of responses keyed by the generated SQL and its
+// arguments, so equivalent requests (GET or POST, any parameter order) share
+// an entry. Every table has a generation that invalidation bumps; a result
+// read before a write finished is not stored once the write invalidated it.
+type selectCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+	lru        *list.List // front is most recently used
+	entries    map[string]*list.Element
+	byTable    map[string]map[string]struct{}
+	bytes      int64
+	generation map[string]uint64
+	epoch      uint64 // bumped by purge and invalidateDatabase
+	stats      cacheStats
+}
+
+func newSelectCache(maxEntries int, maxBytes int64, ttl time.Duration) *selectCache {
+	return &selectCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ttl:        ttl,
+		lru:        list.New(),
+		entries:    map[string]*list.Element{},
+		byTable:    map[string]map[string]struct{}{},
+		generation: map[string]uint64{},
+	}
+}
+
+func cacheTable(dbname, table string) string {
+	return dbname + "." + table
+}
+
+// selectCacheKey identifies a select by its SQL, arguments and whether the
+// total count is included.
+func selectCacheKey(query string, args []interface{}, count bool) string {
+	data, _ := json.Marshal(args)
+	return query + "\x00" + string(data) + "\x00" + strconv.FormatBool(count)
+}
+
+func (c *selectCache) enabled() bool {
+	return c.maxEntries > 0 && c.maxBytes > 0
+}
+
+// get returns the live entry for key and counts the hit or miss.
+func (c *selectCache) get(key string) (*cacheEntry, bool) {
+	if !c.enabled() {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(el)
+			c.stats.Hits++
+			return entry, true
+		}
+		c.remove(el)
+		c.stats.Expired++
+	}
+	c.stats.Misses++
+	return nil, false
+}
+
+// sources returns the tables whose writes can change a select of
+// dbname.table: the table itself and, transitively, the tables its foreign
+// keys cascade from, since a delete or update there changes its rows without
+// a write to it. It returns nil when the result must not be cached: for a
+// view, whose base tables are not tracked, or when the lookup fails.
+func (c *selectCache) sources(ctx context.Context, dbname, table string) []string {
+	if !c.enabled() {
+		return nil
+	}
+	var tableType string
+	err := dbQueryRow(ctx, "SELECT TABLE_TYPE FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?",
+		dbname, table).Scan(&tableType)
+	if err != nil || tableType != "BASE TABLE" {
+		return nil
+	}
+
+	type source struct{ dbname, table string }
+	queue := []source{{dbname, table}}
+	tables := []string{cacheTable(dbname, table)}
+	for len(queue) > 0 {
+		child := queue[0]
+		queue = queue[1:]
+		rows, err := dbQuery(ctx, "SELECT DISTINCT UNIQUE_CONSTRAINT_SCHEMA, REFERENCED_TABLE_NAME "+
+			"FROM information_schema.REFERENTIAL_CONSTRAINTS WHERE CONSTRAINT_SCHEMA = ? AND TABLE_NAME = ? "+
+			"AND (DELETE_RULE NOT IN ('RESTRICT', 'NO ACTION') OR UPDATE_RULE NOT IN ('RESTRICT', 'NO ACTION'))",
+			child.dbname, child.table)
+		if err != nil {
+			return nil
+		}
+		for rows.Next() {
+			var parent source
+			if err := rows.Scan(&parent.dbname, &parent.table); err != nil {
+				rows.Close()
+				return nil
+			}
+			if name := cacheTable(parent.dbname, parent.table); !slices.Contains(tables, name) {
+				tables = append(tables, name)
+				queue = append(queue, parent)
+			}
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			return nil
+		}
+	}
+	return tables
+}
+
+// version returns the current generation of tables, to be passed to put.
+func (c *selectCache) version(tables []string) [2]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.versionLocked(tables)
+}
+
+// versionLocked sums the generations of tables; the sum changes whenever one
+// of them is invalidated.
+func (c *selectCache) versionLocked(tables []string) [2]uint64 {
+	var generation uint64
+	for _, name := range tables {
+		generation += c.generation[name]
+	}
+	return [2]uint64{c.epoch, generation}
+}
+
+// put stores a response read from tables, as returned by sources, when they
+// were at version, with its cachedHeaders. It is dropped if one of them was
+// invalidated since, and never stored without sources.
+func (c *selectCache) put(key string, tables []string, version [2]uint64, header http.Header, body []byte) {
+	if !c.enabled() || len(tables) == 0 || int64(len(body)) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if version != c.versionLocked(tables) {
+		return
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	entry := &cacheEntry{key: key, tables: tables, body: body, header: http.Header{}, expires: time.Now().Add(c.ttl)}
+	for _, name := range cachedHeaders {
+		if v := header.Get(name); v != "" {
+			entry.header.Set(name, v)
+		}
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for _, name := range tables {
+		if c.byTable[name] == nil {
+			c.byTable[name] = map[string]struct{}{}
+		}
+		c.byTable[name][key] = struct{}{}
+	}
+	c.bytes += int64(len(body))
+
+	for len(c.entries) > c.maxEntries || c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *selectCache) remove(el *list.Element) {
+	entry := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, entry.key)
+	for _, name := range entry.tables {
+		if keys := c.byTable[name]; keys != nil {
+			delete(keys, entry.key)
+			if len(keys) == 0 {
+				delete(c.byTable, name)
+			}
+		}
+	}
+	c.bytes -= int64(len(entry.body))
+}
+
+// invalidate drops every cached result read from dbname.table, including
+// those of tables whose foreign keys cascade from it.
+func (c *selectCache) invalidate(dbname, table string) {
+	name := cacheTable(dbname, table)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation[name]++
+	c.stats.Invalidations++
+	for key := range c.byTable[name] {
+		c.remove(c.entries[key])
+	}
+}
+
+// invalidateDatabase drops the cached results of every table of dbname.
+func (c *selectCache) invalidateDatabase(dbname string) {
+	prefix := dbname + "."
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Selects in flight may read tables that have no entries yet; bumping
+	// the epoch keeps them from being stored.
+	c.epoch++
+	c.stats.Invalidations++
+	for name, keys := range c.byTable {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		for key := range keys {
+			c.remove(c.entries[key])
+		}
+	}
+}
+
+// purge drops every cached result, e.g. after a SQL statement whose tables
+// are not known.
+func (c *selectCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	c.stats.Invalidations++
+	c.lru.Init()
+	c.entries = map[string]*list.Element{}
+	c.byTable = map[string]map[string]struct{}{}
+	c.bytes = 0
+}
+
+func (c *selectCache) snapshot() cacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Enabled = c.enabled()
+	stats.Entries = len(c.entries)
+	stats.Bytes = c.bytes
+	stats.MaxEntries = c.maxEntries
+	stats.MaxBytes = c.maxBytes
+	stats.TTL = c.ttl.String()
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+// serveCachedSelect answers r from the cache if it can. Clients bypass the
+// cache with "Cache-Control: no-cache".
+func serveCachedSelect(w http.ResponseWriter, r *http.Request, key string) bool {
+	if strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+		return false
+	}
+	entry, ok := resultCache.get(key)
+	if !ok {
+		return false
+	}
+	for name, values := range entry.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "HIT")
+	w.Write(entry.body)
+	return true
+}
+
+// cacheStatus reports the cache statistics on GET and empties the cache on
+// DELETE (admin only).
+func cacheStatus(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		if !requireAdmin(w, r) {
+			return
+		}
+		resultCache.purge()
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resultCache.snapshot())
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dsnParams pins every connection's session time zone to UTC, so TIMESTAMP
+// values are read and written as UTC whatever the server's zone.
+const dsnParams = "?time_zone=%27%2B00%3A00%27"
+
+// mysqlDateTime is the text form of DATETIME and TIMESTAMP values. TIMESTAMP
+// text is in the session time zone, UTC; DATETIME has no time zone.
+const mysqlDateTime = "2006-01-02 15:04:05.999999"
+
+// localDateTime is the JSON form of DATETIME values: ISO 8601 without a zone
+// offset, since the column does not record one.
+const localDateTime = "2006-01-02T15:04:05.999999"
+
+// resultColumns returns the metadata of a result set's columns.
+func resultColumns(types []*sql.ColumnType) []columnInfo {
+	columns := make([]columnInfo, len(types))
+	for i, t := range types {
+		columns[i] = columnInfo{Name: t.Name(), Type: t.DatabaseTypeName()}
+		if nullable, ok := t.Nullable(); ok {
+			columns[i].Nullable = &nullable
+		}
+	}
+	return columns
+}
+
+// decodeValue converts a value scanned into interface{} to its JSON form
+// according to the column's database type. The driver returns most columns
+// as raw bytes, which encoding/json would otherwise send as base64:
+//
+//	integers, FLOAT, DOUBLE  numbers
+//	DECIMAL                  exact strings
+//	DATETIME                 ISO 8601 strings without a zone
+//	TIMESTAMP                RFC 3339 strings in UTC
+//	JSON                     embedded JSON
+//	BIT                      unsigned numbers
+//	BLOB, BINARY, GEOMETRY   base64 strings
+//	everything else          strings
+//
+// Values that do not parse as their type, such as a zero date, are sent as
+// text rather than dropped.
+func decodeValue(v interface{}, dbType string) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []byte:
+		return decodeBytes(v, dbType)
+	}
+	return v
+}
+
+func decodeBytes(b []byte, dbType string) interface{} {
+	switch {
+	case strings.Contains(dbType, "BLOB") || strings.Contains(dbType, "BINARY") || dbType == "GEOMETRY" || dbType == "VECTOR":
+		return b
+	case dbType == "BIT":
+		if len(b) <= 8 {
+			var buf [8]byte
+			copy(buf[8-len(b):], b)
+			return binary.BigEndian.Uint64(buf[:])
+		}
+		return b
+	}
+
+	s := string(b)
+	switch {
+	case strings.HasPrefix(dbType, "UNSIGNED"):
+		if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return n
+		}
+	case strings.Contains(dbType, "INT") || dbType == "YEAR":
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case dbType == "FLOAT" || dbType == "DOUBLE":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case dbType == "DATETIME":
+		if t, err := time.Parse(mysqlDateTime, s); err == nil {
+			return t.Format(localDateTime)
+		}
+	case dbType == "TIMESTAMP":
+		if t, err := time.Parse(mysqlDateTime, s); err == nil {
+			return t.Format(time.RFC3339Nano)
+		}
+	case dbType == "JSON":
+		if json.Valid(b) {
+			return json.RawMessage(s)
+		}
+	}
+	return s
+}
+
+// decodeRow builds a JSON object from one scanned row.
+func decodeRow(columns []columnInfo, values []interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(columns))
+	for i, col := range columns {
+		row[col.Name] = decodeValue(values[i], col.Type)
+	}
+	return row
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// csvParseError is a malformed CSV record. Reading can continue with the
+// next record.
+type csvParseError struct {
+	msg string
+}
+
+func (e *csvParseError) Error() string { return e.msg }
+
+// csvReader reads CSV records with a configurable delimiter and quote
+// character. Quoted fields may contain delimiters, newlines and doubled
+// quotes; a quote inside an unquoted field is taken literally. CRLF line
+// breaks are read as "\n".
+type csvReader struct {
+	r     *bufio.Reader
+	comma rune
+	quote rune
+	line  int
+}
+
+func newCSVReader(r io.Reader, comma, quote rune) *csvReader {
+	return &csvReader{r: bufio.NewReader(r), comma: comma, quote: quote}
+}
+
+// read returns the next record and the line it starts on, or io.EOF.
+func (c *csvReader) read() ([]string, int, error) {
+	start := c.line + 1
+	var fields []string
+	var field strings.Builder
+	quoted, afterQuote, empty := false, false, true
+
+	for {
+		ch, _, err := c.r.ReadRune()
+		if err == io.EOF {
+			if empty {
+				return nil, start, io.EOF
+			}
+			c.line++
+			if quoted {
+				return nil, start, &csvParseError{"unterminated quoted field"}
+			}
+			return append(fields, field.String()), start, nil
+		}
+		if err != nil {
+			return nil, start, err
+		}
+		empty = false
+
+		switch {
+		case quoted:
+			if ch == c.quote {
+				quoted, afterQuote = false, true
+				continue
+			}
+			if ch == '\r' {
+				// Keep only the \n of a quoted CRLF, like encoding/csv.
+				if next, _ := c.r.Peek(1); len(next) == 1 && next[0] == '\n' {
+					continue
+				}
+			}
+			if ch == '\n' {
+				c.line++
+			}
+			field.WriteRune(ch)
+		case afterQuote && ch == c.quote:
+			// A doubled quote inside a quoted field.
+			field.WriteRune(ch)
+			quoted, afterQuote = true, false
+		case ch == c.comma:
+			fields = append(fields, field.String())
+			field.Reset()
+			afterQuote = false
+		case ch == '\r':
+			if next, _ := c.r.Peek(1); len(next) == 1 && next[0] == '\n' {
+				continue
+			}
+			if afterQuote {
+				return nil, start, c.skipLine("unexpected character after closing quote")
+			}
+			field.WriteRune(ch)
+		case ch == '\n':
+			c.line++
+			return append(fields, field.String()), start, nil
+		case afterQuote:
+			return nil, start, c.skipLine("unexpected character after closing quote")
+		case ch == c.quote && field.Len() == 0:
+			quoted = true
+		default:
+			field.WriteRune(ch)
+		}
+	}
+}
+
+// skipLine discards the rest of the current line and returns a parse error.
+func (c *csvReader) skipLine(msg string) error {
+	for {
+		ch, _, err := c.r.ReadRune()
+		if err != nil || ch == '\n' {
+			c.line++
+			return &csvParseError{msg}
+		}
+	}
+}
+
+// importOptions are the URL parameters of /import.
+type importOptions struct {
+	dbname, table string
+	comma, quote  rune
+	null          *string
+	dryRun        bool
+	chunkSize     int
+}
+
+// singleRune parses a one-character option; "tab" and "\t" mean a tab.
+func singleRune(name, value string, def rune) (rune, error) {
+	switch value {
+	case "":
+		return def, nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(value)
+	if size != len(value) || r == '\n' || r == '\r' {
+		return 0, fmt.Errorf("%s must be a single character", name)
+	}
+	return r, nil
+}
+
+func parseImportOptions(r *http.Request) (importOptions, error) {
+	q := r.URL.Query()
+	opts := importOptions{dbname: q.Get("dbname"), table: q.Get("table")}
+	if opts.dbname == "" || opts.table == "" {
+		return opts, errors.New("Both dbname and table parameters are required")
+	}
+	if _, err := writableTable(opts.dbname, opts.table); err != nil {
+		return opts, err
+	}
+
+	var err error
+	if opts.comma, err = singleRune("delimiter", q.Get("delimiter"), ','); err != nil {
+		return opts, err
+	}
+	if opts.quote, err = singleRune("quote", q.Get("quote"), '"'); err != nil {
+		return opts, err
+	}
+	if opts.comma == opts.quote {
+		return opts, errors.New("delimiter and quote must differ")
+	}
+	if q.Has("null") {
+		null := q.Get("null")
+		opts.null = &null
+	}
+	if v := q.Get("dryRun"); v != "" {
+		if opts.dryRun, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("invalid dryRun %q", v)
+		}
+	}
+	chunkSize := 0
+	if v := q.Get("chunkSize"); v != "" {
+		if chunkSize, err = strconv.Atoi(v); err != nil {
+			return opts, errors.New("Invalid chunkSize")
+		}
+	}
+	opts.chunkSize, err = bulkChunkSize(chunkSize)
+	return opts, err
+}
+
+// columnBaseType returns the lower-case type name of a COLUMN_TYPE such as
+// "int(11) unsigned" → "int".
+func columnBaseType(columnType string) string {
+	t := strings.ToLower(columnType)
+	if i := strings.IndexAny(t, "( "); i >= 0 {
+		t = t[:i]
+	}
+	return t
+}
+
+// isTextType reports whether an empty CSV field is a valid value of t.
+func isTextType(t string) bool {
+	switch t {
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext",
+		"binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob", "set":
+		return true
+	}
+	return false
+}
+
+// enumValues parses the members of "enum('a','b')".
+func enumValues(columnType string) []string {
+	inner := strings.TrimSuffix(strings.TrimPrefix(columnType, "enum("), ")")
+	var values []string
+	for _, v := range strings.Split(inner, "','") {
+		values = append(values, strings.ReplaceAll(strings.Trim(v, "'"), "''", "'"))
+	}
+	return values
+}
+
+var importTimeLayouts = []string{
+	mysqlDateTime,
+	localDateTime,
+	time.RFC3339Nano,
+	"2006-01-02",
+}
+
+// coerceField converts a CSV field to a value of col's type, so bad data is
+// reported per line instead of being truncated or rejected by MySQL
+// mid-chunk.
+func coerceField(col schemaColumn, raw string, null *string) (interface{}, error) {
+	base := columnBaseType(col.Type)
+	if (null != nil && raw == *null) || (raw == "" && !isTextType(base)) {
+		if !col.Nullable {
+			return nil, fmt.Errorf("column %s: missing value for NOT NULL column", col.Name)
+		}
+		return nil, nil
+	}
+
+	invalid := func() error { return fmt.Errorf("column %s: invalid %s value %q", col.Name, col.Type, raw) }
+	unsigned := strings.Contains(strings.ToLower(col.Type), "unsigned")
+	switch base {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "year":
+		if strings.HasPrefix(strings.ToLower(col.Type), "tinyint(1)") {
+			switch strings.ToLower(raw) {
+			case "true", "yes", "y", "t":
+				return 1, nil
+			case "false", "no", "n", "f":
+				return 0, nil
+			}
+		}
+		if unsigned {
+			n, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				return nil, invalid()
+			}
+			return n, nil
+		}
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, invalid()
+		}
+		return n, nil
+	case "bit":
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, invalid()
+		}
+		return n, nil
+	case "decimal", "numeric", "float", "double", "real":
+		// Validate, but pass the text through so decimals keep their precision.
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return nil, invalid()
+		}
+		return raw, nil
+	case "date", "datetime", "timestamp":
+		for _, layout := range importTimeLayouts {
+			if t, err := time.Parse(layout, raw); err == nil {
+				switch base {
+				case "date":
+					return t.Format("2006-01-02"), nil
+				case "timestamp":
+					// Sessions run in UTC; see dsnParams.
+					t = t.UTC()
+				}
+				return t.Format(mysqlDateTime), nil
+			}
+		}
+		return nil, invalid()
+	case "json":
+		if !json.Valid([]byte(raw)) {
+			return nil, invalid()
+		}
+		return raw, nil
+	case "enum":
+		for _, v := range enumValues(col.Type) {
+			if strings.EqualFold(v, raw) {
+				return v, nil
+			}
+		}
+		return nil, invalid()
+	}
+	return raw, nil
+}
+
+// csvBody returns the CSV data of an /import request: the first file part
+// of a multipart upload, or the raw body otherwise.
+func csvBody(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("multipart upload contains no file")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FileName() != "" {
+			return part, nil
+		}
+	}
+}
+
+// importCSV loads a CSV upload into a table. The header row names the
+// columns; every field is converted to its column's type, and lines that do
+// not parse or convert are reported by line number and skipped. Valid rows
+// are inserted and replicated in chunks like /bulk-insert. With dryRun=true
+// nothing is written and only the conversion errors are reported.
+//
+// URL parameters: dbname, table, delimiter (default ","; "tab" for tabs),
+// quote (default "\""), null (field value read as NULL), dryRun, chunkSize.
+func importCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	opts, err := parseImportOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	desc, err := describeTable(r.Context(), opts.dbname, opts.table)
+	if err == errTableNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to describe table: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	columnsByName := make(map[string]schemaColumn, len(desc.Columns))
+	for _, col := range desc.Columns {
+		columnsByName[strings.ToLower(col.Name)] = col
+	}
+
+	body, err := csvBody(r)
+	if err != nil {
+		http.Error(w, "Invalid upload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	reader := newCSVReader(body, opts.comma, opts.quote)
+
+	header, _, err := reader.read()
+	if err == io.EOF {
+		http.Error(w, "CSV is empty", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid header row: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	columns := make([]schemaColumn, len(header))
+	seen := map[string]bool{}
+	for i, name := range header {
+		key := strings.ToLower(strings.TrimSpace(name))
+		col, ok := columnsByName[key]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Header column %q does not exist in %s.%s", name, opts.dbname, opts.table), http.StatusBadRequest)
+			return
+		}
+		if seen[key] {
+			http.Error(w, fmt.Sprintf("Header column %q appears twice", name), http.StatusBadRequest)
+			return
+		}
+		seen[key] = true
+		columns[i] = col
+	}
+
+	readFailed := false
+	next := func() (numberedRow, error) {
+		for !readFailed {
+			fields, line, err := reader.read()
+			if err == io.EOF {
+				break
+			}
+			row := numberedRow{n: line}
+			var parseErr *csvParseError
+			if errors.As(err, &parseErr) {
+				return row, err
+			}
+			if err != nil {
+				readFailed = true
+				return row, fmt.Errorf("read body: %v", err)
+			}
+			if len(fields) == 1 && fields[0] == "" {
+				continue // blank line
+			}
+			if len(fields) != len(columns) {
+				return row, fmt.Errorf("expected %d fields, got %d", len(columns), len(fields))
+			}
+			row.values = make(map[string]interface{}, len(columns))
+			for i, col := range columns {
+				v, err := coerceField(col, fields[i], opts.null)
+				if err != nil {
+					return row, err
+				}
+				row.values[col.Name] = v
+			}
+			return row, nil
+		}
+		return numberedRow{}, io.EOF
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if opts.dryRun {
+		result := bulkResult{Errors: []rowError{}}
+		valid := 0
+		for {
+			row, err := next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				result.Failed++
+				result.Errors = append(result.Errors, rowError{Row: row.n, Error: err.Error()})
+				continue
+			}
+			valid++
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Dry run completed; nothing was written",
+			"dryRun":  true,
+			"valid":   valid,
+			"failed":  result.Failed,
+			"errors":  result.Errors,
+		})
+		return
+	}
+
+	result := loadRows(detachWrite(r.Context()), opts.dbname, opts.table, opts.chunkSize, next)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Import completed",
+		"dryRun":   false,
+		"inserted": result.Inserted,
+		"failed":   result.Failed,
+		"chunks":   result.Chunks,
+		"errors":   result.Errors,
+	})
+}
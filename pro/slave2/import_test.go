@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// csvRecord is one result of csvReader.read.
+type csvRecord struct {
+	fields []string
+	line   int
+	err    string // substring of a *csvParseError, or ""
+}
+
+// readAll reads input to the end the way /import does, continuing after
+// parse errors.
+func readAll(t *testing.T, input string, comma, quote rune) []csvRecord {
+	t.Helper()
+	reader := newCSVReader(strings.NewReader(input), comma, quote)
+	var records []csvRecord
+	for {
+		fields, line, err := reader.read()
+		if err == io.EOF {
+			return records
+		}
+		var parseErr *csvParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			t.Fatalf("read(%q): %v", input, err)
+		}
+		record := csvRecord{fields: fields, line: line}
+		if err != nil {
+			record.err = err.Error()
+		}
+		records = append(records, record)
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		comma rune
+		quote rune
+		want  []csvRecord
+	}{
+		{
+			name:  "plain",
+			input: "a,b,c\n1,2,3\n",
+			want:  []csvRecord{{fields: []string{"a", "b", "c"}, line: 1}, {fields: []string{"1", "2", "3"}, line: 2}},
+		},
+		{
+			name:  "no trailing newline",
+			input: "a,b\n1,",
+			want:  []csvRecord{{fields: []string{"a", "b"}, line: 1}, {fields: []string{"1", ""}, line: 2}},
+		},
+		{
+			name:  "embedded quotes",
+			input: `"say ""hi""",x"y,""` + "\n" + `"""",""""""` + "\n",
+			want: []csvRecord{
+				{fields: []string{`say "hi"`, `x"y`, ""}, line: 1},
+				{fields: []string{`"`, `""`}, line: 2},
+			},
+		},
+		{
+			name:  "CRLF",
+			input: "a,\"b\"\r\n1,2\r\n",
+			want:  []csvRecord{{fields: []string{"a", "b"}, line: 1}, {fields: []string{"1", "2"}, line: 2}},
+		},
+		{
+			name:  "lone CR is data",
+			input: "a\rb,c\n",
+			want:  []csvRecord{{fields: []string{"a\rb", "c"}, line: 1}},
+		},
+		{
+			name:  "quoted newlines",
+			input: "\"one\ntwo\",\"x,\r\ny\"\nnext,row\n",
+			want: []csvRecord{
+				{fields: []string{"one\ntwo", "x,\ny"}, line: 1},
+				{fields: []string{"next", "row"}, line: 4},
+			},
+		},
+		{
+			name:  "blank line",
+			input: "a\n\nb\n",
+			want:  []csvRecord{{fields: []string{"a"}, line: 1}, {fields: []string{""}, line: 2}, {fields: []string{"b"}, line: 3}},
+		},
+		{
+			name:  "custom delimiter and quote",
+			input: "'a;b';'it''s'\n\"x\";y\n",
+			comma: ';',
+			quote: '\'',
+			want: []csvRecord{
+				{fields: []string{"a;b", "it's"}, line: 1},
+				{fields: []string{`"x"`, "y"}, line: 2},
+			},
+		},
+		{
+			name:  "tab delimiter",
+			input: "a\t\"b\tc\"\n",
+			comma: '\t',
+			want:  []csvRecord{{fields: []string{"a", "b\tc"}, line: 1}},
+		},
+		{
+			name:  "character after closing quote",
+			input: "a,b\n\"x\"y,z\n\"multi\nline\"!,z\nc,d\n",
+			want: []csvRecord{
+				{fields: []string{"a", "b"}, line: 1},
+				{line: 2, err: "unexpected character after closing quote"},
+				{line: 3, err: "unexpected character after closing quote"},
+				{fields: []string{"c", "d"}, line: 5},
+			},
+		},
+		{
+			name:  "CR after closing quote",
+			input: "\"x\"\ry\nc\n",
+			want: []csvRecord{
+				{line: 1, err: "unexpected character after closing quote"},
+				{fields: []string{"c"}, line: 2},
+			},
+		},
+		{
+			name:  "unterminated quoted field",
+			input: "a\n\"open\nstill open\n",
+			want:  []csvRecord{{fields: []string{"a"}, line: 1}, {line: 2, err: "unterminated quoted field"}},
+		},
+	}
+	for _, tt := range tests {
+		comma, quote := tt.comma, tt.quote
+		if comma == 0 {
+			comma = ','
+		}
+		if quote == 0 {
+			quote = '"'
+		}
+		got := readAll(t, tt.input, comma, quote)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: read %q = %+v\nwant %+v", tt.name, tt.input, got, tt.want)
+		}
+	}
+}
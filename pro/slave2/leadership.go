@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// leaderMu guards this node's view of the cluster: isMaster, masterAddress,
+// slaveAddresses and electionInProgress. The election and the /promote and
+// /follow handlers change them while requests and replication read them, so
+// everything but start-up goes through the functions below. The slave list
+// is replaced, never modified, so a returned slice stays valid.
+var leaderMu sync.RWMutex
+
+// leaderState returns a consistent snapshot of this node's role, its master
+// and its slaves.
+func leaderState() (master bool, address string, slaves []string) {
+	leaderMu.RLock()
+	defer leaderMu.RUnlock()
+	return isMaster, masterAddress, slaveAddresses
+}
+
+func nodeIsMaster() bool {
+	master, _, _ := leaderState()
+	return master
+}
+
+func currentMaster() string {
+	_, address, _ := leaderState()
+	return address
+}
+
+func currentSlaves() []string {
+	_, _, slaves := leaderState()
+	return slaves
+}
+
+// claimMaster makes this node the master at address. It reports false if the
+// node already was, so a promotion runs once even when an election and
+// /promote race.
+func claimMaster(address string) bool {
+	leaderMu.Lock()
+	defer leaderMu.Unlock()
+	if isMaster {
+		return false
+	}
+	isMaster, masterAddress = true, address
+	return true
+}
+
+// stepDown makes this node a follower of the master at address.
+func stepDown(address string) {
+	leaderMu.Lock()
+	defer leaderMu.Unlock()
+	isMaster, masterAddress, electionInProgress = false, address, false
+}
+
+// follow is stepDown for a node that is not the master; it reports false,
+// changing nothing, if this node is.
+func follow(address string) bool {
+	leaderMu.Lock()
+	defer leaderMu.Unlock()
+	if isMaster {
+		return false
+	}
+	masterAddress, electionInProgress = address, false
+	return true
+}
+
+// beginElection reports whether this node may start an election, i.e. none
+// is in progress, and marks one as started.
+func beginElection() bool {
+	leaderMu.Lock()
+	defer leaderMu.Unlock()
+	if electionInProgress {
+		return false
+	}
+	electionInProgress = true
+	return true
+}
+
+func endElection() {
+	leaderMu.Lock()
+	defer leaderMu.Unlock()
+	electionInProgress = false
+}
+
+// promoteRequest is the body a master sends to /promote when it hands off
+// leadership: the nodes the new master replicates to, and the replication
+// tasks the old master could not deliver before shutting down. A /promote
+// without a body, e.g. from an operator, keeps the node's own slave list.
+type promoteRequest struct {
+	Slaves  []string           `json:"slaves"`
+	Pending []*replicationTask `json:"pending,omitempty"`
+}
+
+// followRequest is the body of /follow.
+type followRequest struct {
+	Master string `json:"master"`
+}
+
+// masterPaths are the endpoints only the master may serve. A node that has
+// them registered but is not the master, such as a former master that
+// restarted after handing off leadership, refuses them.
+var masterPaths = map[string]bool{
+	"/createdb":    true,
+	"/dropdb":      true,
+	"/createtable": true,
+	"/altertable":  true,
+	"/droptable":   true,
+	"/truncate":    true,
+	"/renametable": true,
+	"/createindex": true,
+	"/dropindex":   true,
+	"/versioning":  true,
+	"/migrations":  true,
+	"/migrate":     true,
+	"/rollback":    true,
+	"/insert":      true,
+	"/upsert":      true,
+	"/transaction": true,
+	"/bulk-insert": true,
+	"/import":      true,
+	"/update":      true,
+	"/delete":      true,
+}
+
+// withMasterOnly answers requests for masterPaths with 503 while this node is
+// not the master.
+func withMasterOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if masterPaths[r.URL.Path] && r.Method != http.MethodOptions {
+			if master, address, _ := leaderState(); !master {
+				http.Error(w, "This node is not the master; the master is "+address, http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodePromoteRequest reads the optional body of /promote.
+func decodePromoteRequest(r *http.Request) (promoteRequest, error) {
+	var req promoteRequest
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		return req, err
+	}
+	return req, nil
+}
+
+// takeOver adopts the slave list of the master that handed off leadership
+// and resumes the replication it left unfinished.
+func (req promoteRequest) takeOver(r *http.Request) {
+	if req.Slaves != nil {
+		leaderMu.Lock()
+		slaveAddresses = req.Slaves
+		leaderMu.Unlock()
+	}
+	if len(req.Pending) > 0 {
+		loggerFrom(r.Context()).Info("Resuming replication handed over by the previous master", "tasks", len(req.Pending))
+	}
+	for _, task := range req.Pending {
+		runReplicationTask(r.Context(), task)
+	}
+}
+
+// followMaster points this node at a new master, which a master handing off
+// leadership announces to the slaves it did not promote.
+func followMaster(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req followRequest
+	if err := decodeJSON(r, &req); err != nil || req.Master == "" {
+		http.Error(w, "A master address is required", http.StatusBadRequest)
+		return
+	}
+	if !follow(req.Master) {
+		http.Error(w, "This node is the master", http.StatusConflict)
+		return
+	}
+	loggerFrom(r.Context()).Info("Following new master", "master", req.Master)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Following new master",
+		"master":  req.Master,
+	})
+}
+
+// handOffLeadership asks the slaves, in order, to take over as master and
+// stops at the first one that accepts. The new master gets the other slaves
+// and the undelivered replication tasks; the other slaves are told to follow
+// it. It reports whether a slave took over.
+func handOffLeadership(pending []*replicationTask) bool {
+	client := &http.Client{Timeout: 5 * time.Second}
+	slaves := currentSlaves()
+	for _, addr := range slaves {
+		others := make([]string, 0, len(slaves))
+		for _, other := range slaves {
+			if other != addr {
+				others = append(others, other)
+			}
+		}
+		if err := postJSON(client, addr+"/promote", promoteRequest{Slaves: others, Pending: pending}); err != nil {
+			slog.Warn("Leadership hand-off failed", "slave", addr, "error", err)
+			continue
+		}
+		stepDown(addr)
+		slog.Info("Leadership handed off", "master", addr, "tasks", len(pending))
+
+		for _, other := range others {
+			if err := postJSON(client, other+"/follow", followRequest{Master: addr}); err != nil {
+				slog.Warn("Failed to announce the new master", "slave", other, "error", err)
+			}
+		}
+		return true
+	}
+	slog.Warn("No slave accepted leadership; the remaining nodes will elect a master")
+	return false
+}
+
+// postJSON POSTs v to url and fails unless the answer is 200 OK.
+func postJSON(client *http.Client, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	authorize(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// findMaster returns the first of peers that reports being the master, or ""
+// if none does. A node that restarts consults it so it does not become a
+// second master next to the one it handed leadership to.
+func findMaster(peers []string) string {
+	client := &http.Client{Timeout: 2 * time.Second}
+	for _, addr := range peers {
+		req, err := http.NewRequest(http.MethodGet, addr+"/is-master", nil)
+		if err != nil {
+			continue
+		}
+		authorize(req)
+		resp, err := client.Do(req)
+		if err != nil {
+			continue
+		}
+		var status struct {
+			IsMaster bool `json:"isMaster"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+		if err == nil && status.IsMaster {
+			return addr
+		}
+	}
+	return ""
+}
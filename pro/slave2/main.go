@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	 //"github.com/spf13/cobra"
@@ -18,17 +21,43 @@ var isMaster bool = false
 var masterAddress string = "http://localhost:8001"
 var electionInProgress bool = false
 
+// Slaves do not fan writes out to other nodes, so a promoted slave has no
+// replicas of its own to replicate to or hand leadership over to.
+var slaveAddresses []string
+
 func main() {
-	var err error
-	db, err = sql.Open("mysql", "root:rootroot@tcp(192.168.43.39:3306)/")
+	setupLogging("slave2")
+
+	shutdownTracing, err := setupTracing(context.Background(), "slave2")
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
+	db, err = sql.Open("mysql", "root:rootroot@tcp(192.168.43.39:3306)/"+dsnParams)
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("Failed to open database connection", "error", err)
+		os.Exit(1)
 	}
-	defer db.Close()
 
 	err = db.Ping()
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		slog.Error("Failed to connect to database", "error", err)
+		os.Exit(1)
+	}
+
+	if err := ensureClusterSchema(context.Background()); err != nil {
+		slog.Error("Failed to create cluster metadata schema", "error", err)
+		os.Exit(1)
+	}
+
+	// Refuse to serve a schema that the leader has migrated differently.
+	if err := checkSchemaVersions(context.Background(), masterAddress); errors.Is(err, errSchemaMismatch) {
+		slog.Error("Schema version differs from the leader; apply or roll back migrations first", "master", masterAddress, "error", err)
+		os.Exit(1)
+	} else if err != nil {
+		slog.Warn("Could not compare schema versions with the leader", "master", masterAddress, "error", err)
 	}
 
 	os.Setenv("PORT", "8003")
@@ -37,8 +66,11 @@ func main() {
 	defineBasicRoutes()
 
 	go checkMasterHealth()
-	fmt.Println("Slave server running on port 8003...")
-	log.Fatal(http.ListenAndServe(":8003", nil))
+	slog.Info("Slave server running", "addr", ":8003")
+	if err := serve(":8003", instrument(http.DefaultServeMux)); err != nil {
+		slog.Error("HTTP server stopped", "error", err)
+		os.Exit(1)
+	}
 }
 
 func defineBasicRoutes() {
@@ -48,15 +80,147 @@ func defineBasicRoutes() {
 		w.Write([]byte("pong"))
 	})
 
+	http.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		livez(w, r)
+	})
+
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		readyz(w, r)
+	})
+
 	http.HandleFunc("/is-master", func(w http.ResponseWriter, r *http.Request) {
 		allowCORS(w)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]bool{
-			"isMaster": isMaster,
+			"isMaster": nodeIsMaster(),
 		})
 	})
 
+	http.HandleFunc("/promote", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		promote(w, r)
+	})
+
+	http.HandleFunc("/follow", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		followMaster(w, r)
+	})
+
 	// Define replication routes
+	http.HandleFunc("/schema-versions", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		listSchemaVersions(w, r)
+	})
+
+	http.HandleFunc("/databases", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		listDatabases(w, r)
+	})
+
+	http.HandleFunc("/tables", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		listTables(w, r)
+	})
+
+	http.HandleFunc("/describe", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		describe(w, r)
+	})
+
+	http.HandleFunc("/export", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		exportTable(w, r)
+	})
+
+	http.HandleFunc("/cache", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		cacheStatus(w, r)
+	})
+
+	http.HandleFunc("/running-queries", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		manageRunningQueries(w, r)
+	})
+
+	http.HandleFunc("/query", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		runQuery(w, r)
+	})
+
+	http.HandleFunc("/explain", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		explainQuery(w, r)
+	})
+
+	http.HandleFunc("/named-queries", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		manageNamedQueries(w, r)
+	})
+
+	http.HandleFunc("/call", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		callNamedQuery(w, r)
+	})
+
+	http.HandleFunc("/replicate/query", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		replicateQuery(w, r)
+	})
+
 	http.HandleFunc("/replicate/db", func(w http.ResponseWriter, r *http.Request) {
 		allowCORS(w)
 		replicateDB(w, r)
@@ -72,11 +236,81 @@ func defineBasicRoutes() {
 		replicateTable(w, r)
 	})
 
+	http.HandleFunc("/replicate/altertable", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		replicateAlterTable(w, r)
+	})
+
+	http.HandleFunc("/replicate/droptable", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		replicateDropTable(w, r)
+	})
+
+	http.HandleFunc("/replicate/truncate", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		replicateTruncate(w, r)
+	})
+
+	http.HandleFunc("/replicate/renametable", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		replicateRenameTable(w, r)
+	})
+
+	http.HandleFunc("/replicate/createindex", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		replicateCreateIndex(w, r)
+	})
+
+	http.HandleFunc("/replicate/dropindex", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		replicateDropIndex(w, r)
+	})
+
+	http.HandleFunc("/replicate/versioning", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		manageVersioning(w, r, "")
+	})
+
+	http.HandleFunc("/replicate/migrations", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		replicateMigrations(w, r)
+	})
+
+	http.HandleFunc("/replicate/migrate", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		replicateMigrate(w, r)
+	})
+
+	http.HandleFunc("/replicate/named-queries", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		replicateNamedQuery(w, r)
+	})
+
+	http.HandleFunc("/replicate/drop-named-query", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		replicateDropNamedQuery(w, r)
+	})
+
 	http.HandleFunc("/replicate/insert", func(w http.ResponseWriter, r *http.Request) {
 		allowCORS(w)
 		replicateInsert(w, r)
 	})
 
+	http.HandleFunc("/replicate/bulk-insert", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		replicateBulkInsert(w, r)
+	})
+
+	http.HandleFunc("/replicate/transaction", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		replicateTransaction(w, r)
+	})
+
+	http.HandleFunc("/replicate/upsert", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		replicateUpsert(w, r)
+	})
+
 	http.HandleFunc("/replicate/update", func(w http.ResponseWriter, r *http.Request) {
 		allowCORS(w)
 		replicateUpdate(w, r)
@@ -91,7 +325,8 @@ func defineBasicRoutes() {
 func allowCORS(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, X-Request-Timeout, If-Match")
+	w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, X-Total-Count, X-Cache, ETag")
 }
 
 func replicateDB(w http.ResponseWriter, r *http.Request) {
@@ -101,7 +336,7 @@ func replicateDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := db.Exec("CREATE DATABASE IF NOT EXISTS " + name)
+	_, err := dbExec(r.Context(), "CREATE DATABASE IF NOT EXISTS " + name)
 	if err != nil {
 		http.Error(w, "Failed to create database: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -121,12 +356,13 @@ func replicateDropDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := db.Exec("DROP DATABASE IF EXISTS " + name)
+	_, err := dbExec(r.Context(), "DROP DATABASE IF EXISTS " + name)
 	if err != nil {
 		http.Error(w, "Failed to drop database: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	resultCache.invalidateDatabase(name)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Database dropped successfully",
@@ -145,7 +381,7 @@ func replicateTable(w http.ResponseWriter, r *http.Request) {
 	}
 
 	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s.%s (%s)", dbname, table, schema)
-	_, err := db.Exec(query)
+	_, err := dbExec(r.Context(), query)
 	if err != nil {
 		http.Error(w, "Failed to create table: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -160,29 +396,25 @@ func replicateTable(w http.ResponseWriter, r *http.Request) {
 }
 
 func replicateInsert(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		DBName string `json:"dbname"`
-		Table  string `json:"table"`
-		Values string `json:"values"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	var req insertRequest
+	if err := decodeJSON(r, &req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.DBName == "" || req.Table == "" || req.Values == "" {
-		http.Error(w, "All fields (dbname, table, values) are required", http.StatusBadRequest)
+	query, args, err := buildInsert(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	query := fmt.Sprintf("INSERT INTO %s.%s VALUES (%s)", req.DBName, req.Table, req.Values)
-	result, err := db.Exec(query)
+	result, err := dbExec(r.Context(), query, args...)
 	if err != nil {
 		http.Error(w, "Failed to insert record: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	resultCache.invalidate(req.DBName, req.Table)
 	rowsAffected, _ := result.RowsAffected()
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -192,30 +424,25 @@ func replicateInsert(w http.ResponseWriter, r *http.Request) {
 }
 
 func replicateUpdate(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		DBName string `json:"dbname"`
-		Table  string `json:"table"`
-		Set    string `json:"set"`
-		Where  string `json:"where"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	var req updateRequest
+	if err := decodeJSON(r, &req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.DBName == "" || req.Table == "" || req.Set == "" || req.Where == "" {
-		http.Error(w, "All fields (dbname, table, set, where) are required", http.StatusBadRequest)
+	query, args, err := buildUpdate(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	query := fmt.Sprintf("UPDATE %s.%s SET %s WHERE %s", req.DBName, req.Table, req.Set, req.Where)
-	result, err := db.Exec(query)
+	result, err := dbExec(r.Context(), query, args...)
 	if err != nil {
 		http.Error(w, "Failed to update record: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	resultCache.invalidate(req.DBName, req.Table)
 	rowsAffected, _ := result.RowsAffected()
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -225,29 +452,25 @@ func replicateUpdate(w http.ResponseWriter, r *http.Request) {
 }
 
 func replicateDelete(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		DBName string `json:"dbname"`
-		Table  string `json:"table"`
-		Where  string `json:"where"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	var req deleteRequest
+	if err := decodeJSON(r, &req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.DBName == "" || req.Table == "" || req.Where == "" {
-		http.Error(w, "All fields (dbname, table, where) are required", http.StatusBadRequest)
+	query, args, err := buildDelete(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	query := fmt.Sprintf("DELETE FROM %s.%s WHERE %s", req.DBName, req.Table, req.Where)
-	result, err := db.Exec(query)
+	result, err := dbExec(r.Context(), query, args...)
 	if err != nil {
 		http.Error(w, "Failed to delete record: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	resultCache.invalidate(req.DBName, req.Table)
 	rowsAffected, _ := result.RowsAffected()
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -257,36 +480,35 @@ func replicateDelete(w http.ResponseWriter, r *http.Request) {
 }
 
 func startElection() {
-	if electionInProgress {
+	if !beginElection() {
 		return
 	}
-	electionInProgress = true
 
-	log.Println("Starting master election...")
+	slog.Info("Starting master election")
 	time.Sleep(time.Second * 2)
 
 	// Check if there's already a new master
-	client := &http.Client{Timeout: 5 * time.Second}
-	_, err := client.Get(masterAddress + "/ping")
-	if err == nil {
-		electionInProgress = false
+	if checkReady(currentMaster()) == nil {
+		endElection()
 		return // Another node already became master
 	}
 
 	// Only promote to master if slave1 (8002) is down
 	if os.Getenv("PORT") == "8003" {
 		// Check if slave1 is down
-		_, err := http.Get("http://localhost:8002/ping")
-		if err != nil {
+		if checkReady("http://localhost:8002") != nil {
 			promoteToMaster()
 		}
 	}
 }
 
 func promoteToMaster() {
-	isMaster = true
-	masterAddress = "http://localhost:8003"
-	log.Println("This node has been promoted to master")
+	// Master routes can only be registered once.
+	address := "http://localhost:8003"
+	if !claimMaster(address) {
+		return
+	}
+	slog.Info("This node has been promoted to master", "address", address)
 
 	// Add master endpoints
 	http.HandleFunc("/createdb", func(w http.ResponseWriter, r *http.Request) {
@@ -316,6 +538,96 @@ func promoteToMaster() {
 		createTable(w, r)
 	})
 
+	http.HandleFunc("/altertable", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		alterTable(w, r)
+	})
+
+	http.HandleFunc("/droptable", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		dropTable(w, r)
+	})
+
+	http.HandleFunc("/truncate", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		truncateTable(w, r)
+	})
+
+	http.HandleFunc("/renametable", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		renameTable(w, r)
+	})
+
+	http.HandleFunc("/createindex", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		createIndex(w, r)
+	})
+
+	http.HandleFunc("/dropindex", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		dropIndex(w, r)
+	})
+
+	http.HandleFunc("/versioning", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		manageVersioning(w, r, "/replicate/versioning")
+	})
+
+	http.HandleFunc("/migrations", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		manageMigrations(w, r)
+	})
+
+	http.HandleFunc("/migrate", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		migrate(w, r)
+	})
+
+	http.HandleFunc("/rollback", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		rollbackMigrations(w, r)
+	})
+
 	http.HandleFunc("/insert", func(w http.ResponseWriter, r *http.Request) {
 		allowCORS(w)
 		if r.Method == http.MethodOptions {
@@ -325,11 +637,60 @@ func promoteToMaster() {
 		insertRecord(w, r)
 	})
 
+	http.HandleFunc("/upsert", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		upsertRecord(w, r)
+	})
+
+	http.HandleFunc("/transaction", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		runTransactionBatch(w, r)
+	})
+
+	http.HandleFunc("/bulk-insert", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		bulkInsert(w, r)
+	})
+
+	http.HandleFunc("/import", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		importCSV(w, r)
+	})
+
 	http.HandleFunc("/select", func(w http.ResponseWriter, r *http.Request) {
 		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
 		selectRecords(w, r)
 	})
 
+	http.HandleFunc("/aggregate", func(w http.ResponseWriter, r *http.Request) {
+		allowCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		aggregateRecords(w, r)
+	})
+
 	http.HandleFunc("/update", func(w http.ResponseWriter, r *http.Request) {
 		allowCORS(w)
 		if r.Method == http.MethodOptions {
@@ -349,16 +710,40 @@ func promoteToMaster() {
 	})
 }
 
+// promote makes this node the master on request, e.g. when the current
+// master hands off leadership while shutting down and sends its slaves and
+// unfinished replication along.
+func promote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := decodePromoteRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	promoteToMaster()
+	endElection()
+	req.takeOver(r)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Node promoted to master",
+		"master":  currentMaster(),
+	})
+}
+
 func checkMasterHealth() {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		if !isMaster {
-			client := &http.Client{Timeout: 5 * time.Second}
-			_, err := client.Get(masterAddress + "/ping")
-			if err != nil {
-				log.Printf("Master is down: %v", err)
+		if master, address, _ := leaderState(); !master {
+			if err := checkReady(address); err != nil {
+				slog.Warn("Master is down", "master", address, "error", err)
 				startElection()
 			}
 		}
@@ -373,7 +758,7 @@ func createDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := db.Exec("CREATE DATABASE IF NOT EXISTS " + dbname)
+	_, err := dbExec(detachWrite(r.Context()), "CREATE DATABASE IF NOT EXISTS " + dbname)
 	if err != nil {
 		http.Error(w, "Failed to create database: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -389,13 +774,18 @@ func dropDB(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Database name is required", http.StatusBadRequest)
 		return
 	}
+	if err := writableSchema(dbname); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	_, err := db.Exec("DROP DATABASE IF EXISTS " + dbname)
+	_, err := dbExec(detachWrite(r.Context()), "DROP DATABASE IF EXISTS " + dbname)
 	if err != nil {
 		http.Error(w, "Failed to drop database: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	resultCache.invalidateDatabase(dbname)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Database dropped successfully"})
 }
@@ -409,9 +799,13 @@ func createTable(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "All parameters (dbname, table, schema) are required", http.StatusBadRequest)
 		return
 	}
+	if _, err := writableTable(dbname, table); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s.%s (%s)", dbname, table, schema)
-	_, err := db.Exec(query)
+	_, err := dbExec(detachWrite(r.Context()), query)
 	if err != nil {
 		http.Error(w, "Failed to create table: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -422,139 +816,193 @@ func createTable(w http.ResponseWriter, r *http.Request) {
 }
 
 func insertRecord(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		DBName string `json:"dbname"`
-		Table  string `json:"table"`
-		Values string `json:"values"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	var req insertRequest
+	if err := decodeJSON(r, &req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.DBName == "" || req.Table == "" || req.Values == "" {
-		http.Error(w, "All fields (dbname, table, values) are required", http.StatusBadRequest)
+	query, args, err := buildInsert(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	query := fmt.Sprintf("INSERT INTO %s.%s VALUES (%s)", req.DBName, req.Table, req.Values)
-	_, err := db.Exec(query)
+	result, err := dbExec(detachWrite(r.Context()), query, args...)
 	if err != nil {
 		http.Error(w, "Failed to insert record: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	resultCache.invalidate(req.DBName, req.Table)
+	rowsAffected, _ := result.RowsAffected()
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Record inserted successfully"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Record inserted successfully",
+		"rowsAffected": rowsAffected,
+	})
 }
 
 func selectRecords(w http.ResponseWriter, r *http.Request) {
-	dbname := r.URL.Query().Get("dbname")
-	table := r.URL.Query().Get("table")
-
-	if dbname == "" || table == "" {
-		http.Error(w, "Both dbname and table parameters are required", http.StatusBadRequest)
+	req, err := parseSelectRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	query := fmt.Sprintf("SELECT * FROM %s.%s", dbname, table)
-	rows, err := db.Query(query)
+	var page *keysetPage
+	if req.Keyset || req.Cursor != "" {
+		var status int
+		if page, status, err = newKeysetPage(r.Context(), req); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+
+	query, args, err := buildSelect(req)
+	if page != nil {
+		query, args, err = page.buildSelect(req)
+	}
 	if err != nil {
-		http.Error(w, "Failed to query records: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
 
-	cols, err := rows.Columns()
-	if err != nil {
-		http.Error(w, "Failed to get columns: "+err.Error(), http.StatusInternalServerError)
+	key := selectCacheKey(query, args, req.Count)
+	if req.Stream == "" && serveCachedSelect(w, r, key) {
 		return
 	}
+	// Streams are never cached.
+	var sources []string
+	if req.Stream == "" {
+		sources = resultCache.sources(r.Context(), req.DBName, req.Table)
+	}
+	version := resultCache.version(sources)
 
-	var results []map[string]interface{}
-	for rows.Next() {
-		columns := make([]interface{}, len(cols))
-		columnPointers := make([]interface{}, len(cols))
-		for i := range columns {
-			columnPointers[i] = &columns[i]
+	if req.Count {
+		countQuery, countArgs, _ := buildCount(req)
+		var total int64
+		if err := dbQueryRow(r.Context(), countQuery, countArgs...).Scan(&total); err != nil {
+			http.Error(w, "Failed to count records: "+err.Error(), http.StatusInternalServerError)
+			return
 		}
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+
+	if req.Stream != "" {
+		streamRecords(w, r, req.Stream, query, args)
+		return
+	}
+
+	rows, err := dbQuery(r.Context(), query, args...)
+	if err != nil {
+		http.Error(w, "Failed to query records: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
 
-		if err := rows.Scan(columnPointers...); err != nil {
-			http.Error(w, "Failed to scan row: "+err.Error(), http.StatusInternalServerError)
+	response := map[string]interface{}{}
+	if page != nil {
+		columns, results, next, err := page.scan(rows, req.Limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-
-		row := make(map[string]interface{})
-		for i, col := range cols {
-			val := columnPointers[i].(*interface{})
-			row[col] = *val
+		response["columns"], response["rows"] = columns, results
+		if etag := rowETag(results); etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		response["nextCursor"] = nil
+		if next != "" {
+			response["nextCursor"] = next
+		}
+	} else {
+		columns, results, err := scanResult(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response["columns"], response["rows"] = columns, results
+		if etag := rowETag(results); etag != "" {
+			w.Header().Set("ETag", etag)
 		}
-		results = append(results, row)
 	}
 
-	if err := rows.Err(); err != nil {
-		http.Error(w, "Error during rows iteration: "+err.Error(), http.StatusInternalServerError)
+	data, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Failed to encode result: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	data = append(data, '\n')
+	resultCache.put(key, sources, version, w.Header(), data)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(data)
 }
 
 func updateRecord(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		DBName string `json:"dbname"`
-		Table  string `json:"table"`
-		Set    string `json:"set"`
-		Where  string `json:"where"`
+	var req updateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	expected, err := expectedVersion(r, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if expected != nil {
+		updateIfVersion(w, r, req, *expected)
 		return
 	}
 
-	if req.DBName == "" || req.Table == "" || req.Set == "" || req.Where == "" {
-		http.Error(w, "All fields (dbname, table, set, where) are required", http.StatusBadRequest)
+	query, args, err := buildUpdate(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	query := fmt.Sprintf("UPDATE %s.%s SET %s WHERE %s", req.DBName, req.Table, req.Set, req.Where)
-	_, err := db.Exec(query)
+	result, err := dbExec(detachWrite(r.Context()), query, args...)
 	if err != nil {
 		http.Error(w, "Failed to update record: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	resultCache.invalidate(req.DBName, req.Table)
+	rowsAffected, _ := result.RowsAffected()
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Record updated successfully"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Record updated successfully",
+		"rowsAffected": rowsAffected,
+	})
 }
 
 func deleteRecord(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		DBName string `json:"dbname"`
-		Table  string `json:"table"`
-		Where  string `json:"where"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	var req deleteRequest
+	if err := decodeJSON(r, &req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.DBName == "" || req.Table == "" || req.Where == "" {
-		http.Error(w, "All fields (dbname, table, where) are required", http.StatusBadRequest)
+	query, args, err := buildDelete(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	query := fmt.Sprintf("DELETE FROM %s.%s WHERE %s", req.DBName, req.Table, req.Where)
-	_, err := db.Exec(query)
+	result, err := dbExec(detachWrite(r.Context()), query, args...)
 	if err != nil {
 		http.Error(w, "Failed to delete record: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	resultCache.invalidate(req.DBName, req.Table)
+	rowsAffected, _ := result.RowsAffected()
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Record deleted successfully"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Record deleted successfully",
+		"rowsAffected": rowsAffected,
+	})
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is backed by the global provider, so spans started before
+// setupTracing runs are simply dropped.
+var tracer = otel.Tracer("distributed-db")
+
+// setupTracing installs the global tracer provider and W3C trace-context
+// propagation. OTEL_TRACES_EXPORTER selects the exporter:
+//
+//	stdout  pretty-printed spans on stdout
+//	otlp    OTLP/HTTP to OTEL_EXPORTER_OTLP_ENDPOINT (default localhost:4318)
+//	none    tracing disabled (default)
+//
+// The returned function flushes and stops the provider.
+func setupTracing(ctx context.Context, service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch os.Getenv("OTEL_TRACES_EXPORTER") {
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q", os.Getenv("OTEL_TRACES_EXPORTER"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", service)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// instrument wraps the node's router with a server span per request and the
+// request-ID middleware, so logs and spans share the same correlation data,
+// enforces the admin token, refuses master-only endpoints while the node is
+// not the master, and gives every request its deadline.
+func instrument(next http.Handler) http.Handler {
+	tagged := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace.SpanFromContext(r.Context()).SetAttributes(
+			attribute.String("request.id", requestIDFrom(r.Context())))
+		next.ServeHTTP(w, r)
+	})
+	return otelhttp.NewHandler(withRequestID(withAdminToken(withMasterOnly(withDeadline(tagged)))), "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}))
+}
+
+// replicationClient injects the trace context into outbound replication calls.
+var replicationClient = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+// endSpan records err on span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func startDBSpan(ctx context.Context, op, query string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "mysql."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "mysql"),
+			attribute.String("db.statement", query),
+		))
+}
+
+// dbExec runs db.ExecContext inside a client span. Like dbQuery and
+// dbQueryRow it tags the statement with the request's query tag.
+func dbExec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startDBSpan(ctx, "exec", query)
+	result, err := db.ExecContext(ctx, tagQuery(ctx, query), args...)
+	endSpan(span, err)
+	return result, err
+}
+
+// dbQuery runs db.QueryContext inside a client span. The span covers the
+// round trip that produces the first result set, not the row iteration.
+func dbQuery(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startDBSpan(ctx, "query", query)
+	rows, err := db.QueryContext(ctx, tagQuery(ctx, query), args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+// dbQueryRow runs db.QueryRowContext inside a client span.
+func dbQueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startDBSpan(ctx, "query", query)
+	row := db.QueryRowContext(ctx, tagQuery(ctx, query), args...)
+	endSpan(span, row.Err())
+	return row
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// upsertRequest is the body of /upsert and /replicate/upsert. ConflictKeys
+// names the columns of the table's only primary or unique key; Update lists
+// the columns overwritten when the row already exists and defaults to every
+// non-key column in Values.
+type upsertRequest struct {
+	DBName       string                 `json:"dbname"`
+	Table        string                 `json:"table"`
+	Values       map[string]interface{} `json:"values"`
+	ConflictKeys []string               `json:"conflictKeys"`
+	Update       []string               `json:"update,omitempty"`
+}
+
+// buildUpsert renders INSERT ... ON DUPLICATE KEY UPDATE for req. Columns
+// are emitted in sorted order so master and slaves run identical SQL.
+func buildUpsert(req upsertRequest) (string, []interface{}, error) {
+	if len(req.ConflictKeys) == 0 {
+		return "", nil, errors.New("All fields (dbname, table, values, conflictKeys) are required")
+	}
+	insert, args, err := buildInsert(insertRequest{DBName: req.DBName, Table: req.Table, Values: req.Values})
+	if err != nil {
+		return "", nil, err
+	}
+
+	keys := make(map[string]bool, len(req.ConflictKeys))
+	for _, key := range req.ConflictKeys {
+		if _, ok := req.Values[key]; !ok {
+			return "", nil, fmt.Errorf("conflict key %q has no value", key)
+		}
+		keys[key] = true
+	}
+
+	update := req.Update
+	if len(update) == 0 {
+		for col := range req.Values {
+			if !keys[col] {
+				update = append(update, col)
+			}
+		}
+	}
+	update = append([]string(nil), update...)
+	sort.Strings(update)
+
+	var sets []string
+	for _, name := range update {
+		if _, ok := req.Values[name]; !ok {
+			return "", nil, fmt.Errorf("update column %q has no value", name)
+		}
+		col, err := quoteIdent(name)
+		if err != nil {
+			return "", nil, err
+		}
+		sets = append(sets, col+" = VALUES("+col+")")
+	}
+	if len(sets) == 0 {
+		// Only key columns were given: keep the existing row untouched.
+		col, _ := quoteIdent(req.ConflictKeys[0])
+		sets = append(sets, col+" = "+col)
+	}
+
+	return insert + " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", "), args, nil
+}
+
+// uniqueConflictKey checks that keys are exactly the columns of the table's
+// only unique key. ON DUPLICATE KEY UPDATE fires on a clash with any unique
+// key, so on a table with several the row updated need not be the one keys
+// identify, and MySQL flags the statement unsafe for statement-based
+// replication.
+func uniqueConflictKey(indexes []schemaIndex, keys []string) error {
+	var unique []schemaIndex
+	for _, index := range indexes {
+		if index.Unique {
+			unique = append(unique, index)
+		}
+	}
+	switch len(unique) {
+	case 0:
+		return errors.New("upsert requires a table with a primary or unique key")
+	case 1:
+	default:
+		names := make([]string, len(unique))
+		for i, index := range unique {
+			names[i] = index.Name
+		}
+		return fmt.Errorf("upsert requires a table with exactly one primary or unique key; this table has %d (%s)",
+			len(unique), strings.Join(names, ", "))
+	}
+	index := unique[0]
+	matches := len(keys) == len(index.Columns)
+	for _, col := range index.Columns {
+		matches = matches && containsFold(keys, col)
+	}
+	if !matches {
+		return fmt.Errorf("conflictKeys must be the columns of the %s key: %s", index.Name, strings.Join(index.Columns, ", "))
+	}
+	return nil
+}
+
+// checkConflictKeys applies uniqueConflictKey to the table req writes. The
+// returned status is the HTTP status for a non-nil error.
+func checkConflictKeys(ctx context.Context, req upsertRequest) (int, error) {
+	desc, err := describeTable(ctx, req.DBName, req.Table)
+	if err == errTableNotFound {
+		return http.StatusNotFound, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Failed to describe table: %v", err)
+	}
+	if err := uniqueConflictKey(desc.Indexes, req.ConflictKeys); err != nil {
+		return http.StatusBadRequest, err
+	}
+	return 0, nil
+}
+
+// upsertOutcome translates MySQL's affected-row count for
+// INSERT ... ON DUPLICATE KEY UPDATE.
+func upsertOutcome(rowsAffected int64) string {
+	switch rowsAffected {
+	case 1:
+		return "inserted"
+	case 2:
+		return "updated"
+	default:
+		return "unchanged"
+	}
+}
+
+func upsertRecord(w http.ResponseWriter, r *http.Request) {
+	var req upsertRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	query, args, err := buildUpsert(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, err := checkConflictKeys(r.Context(), req); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	result, err := dbExec(detachWrite(r.Context()), query, args...)
+	if err != nil {
+		http.Error(w, "Failed to upsert record: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resultCache.invalidate(req.DBName, req.Table)
+
+	replicateToSlavesJSON(r.Context(), "/replicate/upsert", req)
+	rowsAffected, _ := result.RowsAffected()
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Record upserted successfully",
+		"outcome":      upsertOutcome(rowsAffected),
+		"rowsAffected": rowsAffected,
+	})
+}
+
+func replicateUpsert(w http.ResponseWriter, r *http.Request) {
+	var req upsertRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	query, args, err := buildUpsert(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := dbExec(r.Context(), query, args...)
+	if err != nil {
+		http.Error(w, "Failed to upsert record: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resultCache.invalidate(req.DBName, req.Table)
+
+	rowsAffected, _ := result.RowsAffected()
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Record upserted successfully",
+		"outcome":      upsertOutcome(rowsAffected),
+		"rowsAffected": rowsAffected,
+	})
+}
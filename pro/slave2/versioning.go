@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// versionColumn is the optional, cluster-managed row version. Enabling
+// versioning on a table adds the column, starting every row at 1, and a
+// trigger that increments it on every update, whether it comes from /update,
+// /upsert, /transaction, /query or replication.
+const versionColumn = "_version"
+
+// errVersionColumn rejects writes and DDL that name versionColumn, which only
+// /versioning and its trigger may change.
+var errVersionColumn = errors.New(versionColumn + " is managed by the cluster; use /versioning to add or remove it")
+
+// versionTriggerPrefix names the trigger that maintains versionColumn.
+const versionTriggerPrefix = "_version_"
+
+// versionTriggerName returns a new name for the version trigger of table:
+// the prefix, as much of the table name as fits and a random suffix. The
+// suffix keeps the name unique, since a trigger keeps its name when its table
+// is renamed and another table may then take the old name.
+func versionTriggerName(table string) string {
+	suffix := "_" + randomHex(8)
+	if room := 64 - len(versionTriggerPrefix) - len(suffix); len(table) > room {
+		table = table[:room]
+	}
+	return versionTriggerPrefix + table + suffix
+}
+
+// hasRowVersion reports whether dbname.table has the version column.
+func hasRowVersion(ctx context.Context, dbname, table string) (bool, error) {
+	var n int
+	err := dbQueryRow(ctx, "SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+		dbname, table, versionColumn).Scan(&n)
+	return n > 0, err
+}
+
+// versionTrigger returns the name of the version trigger of dbname.table, or
+// "" if it has none.
+func versionTrigger(ctx context.Context, dbname, table string) (string, error) {
+	var name string
+	err := dbQueryRow(ctx, "SELECT TRIGGER_NAME FROM information_schema.TRIGGERS "+
+		"WHERE EVENT_OBJECT_SCHEMA = ? AND EVENT_OBJECT_TABLE = ? AND TRIGGER_NAME LIKE ? LIMIT 1",
+		dbname, table, strings.ReplaceAll(versionTriggerPrefix, "_", `\_`)+"%").Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return name, err
+}
+
+// setVersioning adds or removes the version column and its trigger. Both
+// directions are idempotent, so a replayed replication call succeeds.
+func setVersioning(ctx context.Context, dbname, table string, enable bool) error {
+	qualified, err := qualifiedTable(dbname, table)
+	if err != nil {
+		return err
+	}
+	column, _ := quoteIdent(versionColumn)
+	hasColumn, err := hasRowVersion(ctx, dbname, table)
+	if err != nil {
+		return err
+	}
+	trigger, err := versionTrigger(ctx, dbname, table)
+	if err != nil {
+		return err
+	}
+	schema, _ := quoteIdent(dbname)
+
+	if !enable {
+		if trigger != "" {
+			name, _ := quoteIdent(trigger)
+			if _, err := dbExec(ctx, "DROP TRIGGER IF EXISTS "+schema+"."+name); err != nil {
+				return err
+			}
+		}
+		if hasColumn {
+			_, err = dbExec(ctx, "ALTER TABLE "+qualified+" DROP COLUMN "+column)
+		}
+		return err
+	}
+
+	if !hasColumn {
+		if _, err := dbExec(ctx, "ALTER TABLE "+qualified+" ADD COLUMN "+column+" BIGINT UNSIGNED NOT NULL DEFAULT 1"); err != nil {
+			return err
+		}
+	}
+	if trigger == "" {
+		name, err := quoteIdent(versionTriggerName(table))
+		if err == nil {
+			_, err = dbExec(ctx, "CREATE TRIGGER "+schema+"."+name+" BEFORE UPDATE ON "+qualified+
+				" FOR EACH ROW SET NEW."+column+" = OLD."+column+" + 1")
+		}
+		if err != nil {
+			if !hasColumn {
+				dbExec(ctx, "ALTER TABLE "+qualified+" DROP COLUMN "+column)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// manageVersioning enables row versioning on dbname.table on POST and
+// disables it on DELETE. replicatePath, when set, replays the call on the
+// slaves.
+func manageVersioning(w http.ResponseWriter, r *http.Request, replicatePath string) {
+	var enable bool
+	switch r.Method {
+	case http.MethodPost:
+		enable = true
+	case http.MethodDelete:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	dbname, table := q.Get("dbname"), q.Get("table")
+	if dbname == "" || table == "" {
+		http.Error(w, "Both dbname and table parameters are required", http.StatusBadRequest)
+		return
+	}
+	if _, err := writableTable(dbname, table); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := setVersioning(detachWrite(r.Context()), dbname, table, enable); err != nil {
+		http.Error(w, "Failed to change row versioning: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resultCache.invalidate(dbname, table)
+
+	if replicatePath != "" {
+		replicate(r.Context(), r.Method, replicatePath+"?"+q.Encode(), nil)
+	}
+	message := "Row versioning disabled"
+	if enable {
+		message = "Row versioning enabled"
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// expectedVersion returns the version an update requires the row to have:
+// req.ExpectedVersion or an If-Match entity tag such as "3", as /select
+// returns for a single row. Nil means the update is unconditional.
+func expectedVersion(r *http.Request, req updateRequest) (*uint64, error) {
+	match := strings.TrimSpace(r.Header.Get("If-Match"))
+	if match == "" || match == "*" {
+		return req.ExpectedVersion, nil
+	}
+	v, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(match, "W/"), `"`), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid If-Match %q; expected a row version such as \"3\"", match)
+	}
+	if req.ExpectedVersion != nil && *req.ExpectedVersion != v {
+		return nil, errors.New("If-Match and expectedVersion disagree")
+	}
+	return &v, nil
+}
+
+// versionETag renders a row version as an entity tag.
+func versionETag(v uint64) string {
+	return `"` + strconv.FormatUint(v, 10) + `"`
+}
+
+// rowETag returns the entity tag of a /select result that is a single row of
+// a versioned table, including its version column, to be sent back in
+// If-Match. It returns "" for any other result.
+func rowETag(results []map[string]interface{}) string {
+	if len(results) != 1 {
+		return ""
+	}
+	v, ok := results[0][versionColumn]
+	if !ok {
+		return ""
+	}
+	n, err := strconv.ParseUint(fmt.Sprint(v), 10, 64)
+	if err != nil {
+		return ""
+	}
+	return versionETag(n)
+}
+
+// updateIfVersion applies req to the single row it matches, provided the row
+// is still at version expected, and answers 409 Conflict with the current
+// version in the ETag header if it is not. The row is locked between the
+// check and the update. Replicas receive the plain update.
+func updateIfVersion(w http.ResponseWriter, r *http.Request, req updateRequest, expected uint64) {
+	query, args, err := buildUpdate(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	table, _ := qualifiedTable(req.DBName, req.Table)
+	where, whereArgs, _ := req.Where.build()
+
+	ctx := detachWrite(r.Context())
+	versioned, err := hasRowVersion(ctx, req.DBName, req.Table)
+	if err != nil {
+		http.Error(w, "Failed to update record: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !versioned {
+		http.Error(w, fmt.Sprintf("Row versioning is not enabled on %s.%s", req.DBName, req.Table), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		http.Error(w, "Failed to update record: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	column, _ := quoteIdent(versionColumn)
+	rows, err := tx.QueryContext(ctx, tagQuery(ctx, "SELECT "+column+" FROM "+table+" WHERE "+where+" LIMIT 2 FOR UPDATE"), whereArgs...)
+	if err != nil {
+		http.Error(w, "Failed to update record: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var versions []uint64
+	for rows.Next() {
+		var v uint64
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			http.Error(w, "Failed to update record: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		versions = append(versions, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to update record: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case len(versions) == 0:
+		http.Error(w, "No record matches the filter", http.StatusNotFound)
+		return
+	case len(versions) > 1:
+		http.Error(w, "A versioned update needs a filter that matches exactly one record", http.StatusBadRequest)
+		return
+	case versions[0] != expected:
+		w.Header().Set("ETag", versionETag(versions[0]))
+		http.Error(w, fmt.Sprintf("Record has changed since it was read (version %d, expected %d)", versions[0], expected), http.StatusConflict)
+		return
+	}
+
+	if _, err := tx.ExecContext(ctx, tagQuery(ctx, query), args...); err != nil {
+		http.Error(w, "Failed to update record: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update record: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resultCache.invalidate(req.DBName, req.Table)
+	req.ExpectedVersion = nil
+	replicateToSlavesJSON(ctx, "/replicate/update", req)
+	w.Header().Set("ETag", versionETag(expected+1))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Record updated successfully",
+		"rowsAffected": 1,
+		"version":      expected + 1,
+	})
+}